@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bautitobal/waybar-stocks/internal/config"
+	"github.com/bautitobal/waybar-stocks/internal/ctl"
+	"github.com/bautitobal/waybar-stocks/internal/state"
+)
+
+// clockStep is the rotation step derived from the wall clock. One-shot runs
+// and the daemon share it so the persisted offsets mean the same to both.
+func clockStep(cfg *config.Config) int {
+	return int(time.Now().Unix() / int64(secondsOr(cfg.RotationInterval, 5)/time.Second))
+}
+
+// untilNextStep returns the time left until clockStep changes.
+func untilNextStep(cfg *config.Config) time.Duration {
+	interval := secondsOr(cfg.RotationInterval, 5)
+	return interval - time.Duration(time.Now().UnixNano())%interval
+}
+
+// displayStep returns the step to render: the pinned asset in rotate mode,
+// otherwise the clock step adjusted by the persisted state.
+func displayStep(cfg *config.Config, st state.State) int {
+	if st.Pinned != "" && cfg.DisplayMode == config.DisplayRotate {
+		for i, a := range cfg.Assets {
+			if strings.EqualFold(a.Symbol, st.Pinned) || strings.EqualFold(a.Name, st.Pinned) {
+				return i
+			}
+		}
+	}
+	return st.Step(clockStep(cfg))
+}
+
+// move shifts the displayed asset by n from wherever it is now, pinned or not.
+func move(cfg *config.Config, st *state.State, n int) {
+	st.Seek(clockStep(cfg), displayStep(cfg, *st)+n)
+}
+
+// runControl implements --next, --prev, --pause and --pin. A running daemon
+// is asked to apply next and prev itself, over its control socket or, if
+// that is disabled, with SIGUSR1 and SIGUSR2; everything else updates the
+// state file, which the daemon watches.
+func runControl(cfg *config.Config, next, prev, pause bool, pin *string) error {
+	if (next || prev) && !pause && pin == nil {
+		cmd, sig := "next", syscall.SIGUSR1
+		if prev {
+			cmd, sig = "prev", syscall.SIGUSR2
+		}
+		if _, err := ctl.Call(ctl.SocketPath(), ctl.Request{Cmd: cmd}); err == nil {
+			return nil
+		}
+		if pid, ok := state.DaemonPID(); ok {
+			return syscall.Kill(pid, sig)
+		}
+	}
+	_, err := state.Update(func(st *state.State) {
+		if pin != nil {
+			st.Pin(*pin)
+		}
+		if next {
+			move(cfg, st, 1)
+		}
+		if prev {
+			move(cfg, st, -1)
+		}
+		if pause {
+			st.TogglePause(clockStep(cfg))
+		}
+	})
+	return err
+}
+
+// loadState reads the persisted state, warning on errors.
+func loadState() state.State {
+	st, err := state.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: could not read state: %v\n", err)
+	}
+	return st
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bautitobal/waybar-stocks/internal/config"
+	"github.com/bautitobal/waybar-stocks/internal/ctl"
+	"github.com/bautitobal/waybar-stocks/internal/fetcher"
+	"github.com/bautitobal/waybar-stocks/internal/state"
+)
+
+// call is a control request waiting for the run loop to answer it.
+type call struct {
+	req   ctl.Request
+	reply chan ctl.Response
+}
+
+// call hands req to the run loop, so handlers never race with it.
+func (d *daemon) call(req ctl.Request) ctl.Response {
+	c := call{req: req, reply: make(chan ctl.Response, 1)}
+	d.calls <- c
+	return <-c.reply
+}
+
+// statusReply is the "status" payload.
+type statusReply struct {
+	PID         int         `json:"pid"`
+	Config      string      `json:"config"`
+	Started     time.Time   `json:"started"`
+	LastRefresh time.Time   `json:"last_refresh"`
+	Assets      int         `json:"assets"`
+	DisplayMode string      `json:"display_mode"`
+	State       state.State `json:"state"`
+	Subscribers int         `json:"subscribers"`
+}
+
+// quoteReply is one asset of the "quotes" payload.
+type quoteReply struct {
+	Symbol    string         `json:"symbol"`
+	Name      string         `json:"name"`
+	Timeframe string         `json:"timeframe,omitempty"`
+	Quote     *fetcher.Quote `json:"quote,omitempty"`
+	FetchedAt time.Time      `json:"fetched_at,omitzero"`
+	Error     string         `json:"error,omitempty"`
+	// Live is set while a streaming feed updates the quote
+	Live bool `json:"live,omitempty"`
+}
+
+// handle answers a control request from within the run loop.
+func (d *daemon) handle(ctx context.Context, req ctl.Request) ctl.Response {
+	switch req.Cmd {
+	case "status":
+		return ctl.Reply(statusReply{
+			PID:         os.Getpid(),
+			Config:      d.configPath,
+			Started:     d.started,
+			LastRefresh: d.lastRefresh,
+			Assets:      len(d.cfg.Assets),
+			DisplayMode: d.cfg.DisplayMode,
+			State:       loadState(),
+			Subscribers: d.server.Subscribers(),
+		})
+	case "quotes":
+		quotes := make([]quoteReply, len(d.cfg.Assets))
+		for i, a := range d.cfg.Assets {
+			st := d.states[i]
+			quotes[i] = quoteReply{Symbol: a.Symbol, Name: a.Name, Timeframe: a.Timeframe, Quote: st.quote, FetchedAt: st.fetchedAt, Live: st.live}
+			if st.err != nil {
+				quotes[i].Error = st.err.Error()
+			}
+		}
+		return ctl.Reply(quotes)
+	case "refresh":
+		// bypass the quote cache: the caller wants fresh quotes now
+		refreshStates(ctx, d.cfg, d.states, 0)
+		d.lastRefresh = time.Now()
+	case "next", "prev":
+		n := 1
+		if req.Cmd == "prev" {
+			n = -1
+		}
+		if _, err := state.Update(func(st *state.State) { move(d.cfg, st, n) }); err != nil {
+			return ctl.Fail(err)
+		}
+	case "pause":
+		if _, err := state.Update(func(st *state.State) { st.TogglePause(clockStep(d.cfg)) }); err != nil {
+			return ctl.Fail(err)
+		}
+	case "pin":
+		symbol := ""
+		if len(req.Args) > 0 {
+			symbol = req.Args[0]
+		}
+		if _, err := state.Update(func(st *state.State) { st.Pin(symbol) }); err != nil {
+			return ctl.Fail(err)
+		}
+	case "reload-config":
+		if err := d.reloadConfig(ctx); err != nil {
+			return ctl.Fail(err)
+		}
+		return ctl.Reply(nil)
+	default:
+		return ctl.Fail(fmt.Errorf("unknown command %q (known: %s)", req.Cmd, ctlCommands))
+	}
+	d.print()
+	return ctl.Reply(nil)
+}
+
+const ctlCommands = "status, quotes, refresh, next, prev, pause, pin, reload-config, subscribe"
+
+// reload re-reads the config file. An invalid config is rejected and the
+// running one kept. Assets present in both keep their quotes.
+func (d *daemon) reload() error {
+	cfg, err := config.LoadConfig(d.configPath)
+	if err == nil {
+		err = cfg.ConfigureProviders()
+	}
+	if err != nil {
+		return err
+	}
+	old := make(map[fetcher.Request]assetState, len(d.cfg.Assets))
+	for i, a := range d.cfg.Assets {
+		old[assetRequest(a)] = d.states[i]
+	}
+	states := make([]assetState, len(cfg.Assets))
+	for i, a := range cfg.Assets {
+		states[i] = old[assetRequest(a)]
+	}
+	d.cfg, d.states = cfg, states
+	return nil
+}
+
+// assetRequest identifies what is fetched for an asset.
+func assetRequest(a config.Asset) fetcher.Request {
+	return fetcher.Request{Provider: a.Provider, Symbol: a.Symbol, Timeframe: a.Timeframe}
+}
+
+// runCtl implements `waybar-stocks ctl <command> [args]` and returns the
+// exit code. "subscribe" prints every update of the daemon as a Waybar JSON
+// line, so further bars can share one daemon.
+func runCtl(args []string) int {
+	fs := flag.NewFlagSet("ctl", flag.ExitOnError)
+	socket := fs.String("socket", ctl.SocketPath(), "Path to the daemon's control socket")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: waybar-stocks ctl [--socket <path>] <command> [args]\ncommands: %s\n", ctlCommands)
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	req := ctl.Request{Cmd: fs.Arg(0), Args: fs.Args()[1:]}
+	if req.Cmd == ctl.Subscribe {
+		err := ctl.Stream(*socket, func(line []byte) error {
+			_, err := fmt.Printf("%s\n", line)
+			return err
+		})
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	resp, err := ctl.Call(*socket, req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if len(resp.Data) > 0 {
+		var b bytes.Buffer
+		json.Indent(&b, resp.Data, "", "  ")
+		fmt.Println(b.String())
+	}
+	return 0
+}
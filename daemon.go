@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/bautitobal/waybar-stocks/internal/config"
+	"github.com/bautitobal/waybar-stocks/internal/ctl"
+	"github.com/bautitobal/waybar-stocks/internal/fetcher"
+	"github.com/bautitobal/waybar-stocks/internal/formatter"
+	"github.com/bautitobal/waybar-stocks/internal/state"
+)
+
+// daemon keeps the latest quote of every configured asset in memory and
+// streams one Waybar JSON object per line.
+type daemon struct {
+	cfg        *config.Config
+	configPath string
+	out        io.Writer
+	states     []assetState
+	// lastLine and lastPrint are the last output and when it was written
+	lastLine  []byte
+	lastPrint time.Time
+	// stateMod is the mtime of the state file when last read
+	stateMod time.Time
+
+	// control socket; calls carries its requests into the run loop
+	server      *ctl.Server
+	calls       chan call
+	started     time.Time
+	lastRefresh time.Time
+
+	refreshTicker *time.Ticker
+	// configErr is why the last config reload was rejected, shown in the tooltip
+	configErr error
+
+	// streaming feeds (see stream.go)
+	events        chan fetcher.StreamEvent
+	cancelStreams context.CancelFunc
+	feedAssets    map[string]map[string][]int
+	redraw        *time.Timer
+	redrawPending bool
+}
+
+func newDaemon(cfg *config.Config, configPath string, out io.Writer) *daemon {
+	return &daemon{
+		cfg:        cfg,
+		configPath: configPath,
+		out:        out,
+		states:     make([]assetState, len(cfg.Assets)),
+		calls:      make(chan call),
+		started:    time.Now(),
+		events:     make(chan fetcher.StreamEvent, 64),
+	}
+}
+
+// run refreshes every asset on refresh_interval and rotates the displayed
+// asset (or scrolls the marquee) on rotation_interval until ctx is cancelled.
+// SIGUSR1 and SIGUSR2 move to the next and previous asset, and changes to
+// the state file (--pause, --pin) are picked up within a second. Control
+// socket requests are served between ticks, and edits to the config file
+// are applied as they are saved. With streaming enabled, crypto quotes are
+// also updated from WebSocket feeds as they tick.
+func (d *daemon) run(ctx context.Context) {
+	if remove, err := state.WritePID(); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: could not write pid file: %v\n", err)
+	} else {
+		defer remove()
+	}
+	if srv, err := ctl.Listen(ctl.SocketPath(), d.call); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: control socket disabled: %v\n", err)
+	} else {
+		d.server = srv
+		defer srv.Close()
+		go srv.Serve()
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	defer signal.Stop(signals)
+
+	d.refreshTicker = time.NewTicker(secondsOr(d.cfg.RefreshInterval, 60))
+	defer d.refreshTicker.Stop()
+	rotate := time.NewTimer(untilNextStep(d.cfg))
+	defer rotate.Stop()
+	watch := time.NewTicker(time.Second)
+	defer watch.Stop()
+	configChanges := config.Watch(ctx, d.configPath, 2*time.Second)
+	d.redraw = time.NewTimer(0)
+	d.redraw.Stop()
+	defer d.redraw.Stop()
+	defer d.stopStreams()
+
+	d.refresh(ctx)
+	d.print()
+	d.startStreams(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.refreshTicker.C:
+			d.refresh(ctx)
+			d.print()
+		case <-rotate.C:
+			rotate.Reset(untilNextStep(d.cfg))
+			d.print()
+		case sig := <-signals:
+			n := 1
+			if sig == syscall.SIGUSR2 {
+				n = -1
+			}
+			if _, err := state.Update(func(st *state.State) { move(d.cfg, st, n) }); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: could not save state: %v\n", err)
+			}
+			d.print()
+		case <-configChanges:
+			d.reloadConfig(ctx)
+		case c := <-d.calls:
+			c.reply <- d.handle(ctx, c.req)
+		case ev := <-d.events:
+			d.onStream(ev)
+		case <-d.redraw.C:
+			d.redrawPending = false
+			d.print()
+		case <-watch.C:
+			if info, err := os.Stat(state.Path()); err == nil && !info.ModTime().Equal(d.stateMod) {
+				d.print()
+			}
+		}
+	}
+}
+
+// refresh fetches every asset, keeping the previous quote when a fetch fails.
+func (d *daemon) refresh(ctx context.Context) {
+	refreshStates(ctx, d.cfg, d.states, secondsOr(d.cfg.RefreshInterval, 60))
+	d.lastRefresh = time.Now()
+}
+
+// reloadConfig swaps in the config file's current contents. If it is
+// invalid the running config stays active and the error is shown in the
+// tooltip until a valid config is saved.
+func (d *daemon) reloadConfig(ctx context.Context) error {
+	err := d.reload()
+	d.configErr = err
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Config reload rejected, keeping the previous config: %v\n", err)
+	} else {
+		d.refreshTicker.Reset(secondsOr(d.cfg.RefreshInterval, 60))
+		// unchanged assets are served from the cache, new ones are fetched
+		d.stopStreams()
+		d.refresh(ctx)
+		d.startStreams(ctx)
+	}
+	d.print()
+	return err
+}
+
+// print writes the current output as one JSON line, unless it is the same
+// as the last one.
+func (d *daemon) print() {
+	if len(d.cfg.Assets) == 0 {
+		return
+	}
+	if info, err := os.Stat(state.Path()); err == nil {
+		d.stateMod = info.ModTime()
+	}
+	out := render(d.cfg, d.states, displayStep(d.cfg, loadState()))
+	if d.configErr != nil {
+		out.Class = append(out.Class, "config-error")
+		out.Tooltip = formatter.EscapeMarkup(fmt.Sprintf("Config error, keeping the previous config:\n%v", d.configErr)) + "\n\n" + out.Tooltip
+	}
+	line, err := json.Marshal(out)
+	if err != nil || bytes.Equal(line, d.lastLine) {
+		return
+	}
+	d.lastLine, d.lastPrint = line, time.Now()
+	d.out.Write(append(line, '\n'))
+	if d.server != nil {
+		d.server.Publish(out)
+	}
+}
+
+// refreshStates fetches every asset concurrently into states, serving cached
+// quotes younger than ttl. Assets whose fetch failed keep their previous
+// quote, or are seeded from the shared cache, so they can still be shown as
+// stale. Live streamed assets with a daily timeframe are left to their feed.
+func refreshStates(ctx context.Context, cfg *config.Config, states []assetState, ttl time.Duration) {
+	var reqs []fetcher.Request
+	var indexes []int
+	for i, a := range cfg.Assets {
+		if states[i].live && fetcher.IsDaily(a.Timeframe) {
+			continue
+		}
+		reqs = append(reqs, assetRequest(a))
+		indexes = append(indexes, i)
+	}
+	results := fetcher.FetchAll(ctx, reqs, fetcher.FetchOptions{TTL: ttl})
+	for j, r := range results {
+		i := indexes[j]
+		st := &states[i]
+		st.err = r.Err
+		if r.Err != nil {
+			fmt.Fprintf(os.Stderr, "Error fetching %s: %v\n", cfg.Assets[i].Symbol, r.Err)
+			if st.quote == nil {
+				if cached, fetchedAt, ok := fetcher.CachedQuote(reqs[j].Provider, reqs[j].Symbol, reqs[j].Timeframe); ok {
+					st.quote, st.fetchedAt = cached, fetchedAt
+				}
+			}
+			continue
+		}
+		st.quote, st.fetchedAt = r.Quote, r.FetchedAt
+	}
+}
+
+func secondsOr(n, fallback int) time.Duration {
+	if n <= 0 {
+		n = fallback
+	}
+	return time.Duration(n) * time.Second
+}
@@ -1,8 +1,12 @@
 package config
 
 import (
+	"bytes"
+	"cmp"
+	"io"
 	"os"
 
+	"github.com/bautitobal/waybar-stocks/internal/formatter"
 	"gopkg.in/yaml.v3"
 )
 
@@ -11,30 +15,221 @@ type Asset struct {
 	Name   string `yaml:"name"`
 	// optional timeframe for percent change (e.g. "1D", "3D", "1W", "1M", "1Y", "15m")
 	Timeframe string `yaml:"timeframe,omitempty"`
+	// optional provider name (e.g. "yahoo", "coingecko", "dolarapi") overriding automatic routing
+	Provider string `yaml:"provider,omitempty"`
+	// optional CoinGecko coin id (e.g. "pepe") for tickers shared by several coins
+	CoinGeckoID string `yaml:"coingecko_id,omitempty"`
+	// optional overrides of the global format, colors, icon and arrows;
+	// unset values inherit the global ones
+	Format string `yaml:"format,omitempty"`
+	Colors Colors `yaml:"colors,omitempty"`
+	Icon   string `yaml:"icon,omitempty"`
+	Arrows Arrows `yaml:"arrows,omitempty"`
+	// optional number formatting overriding the global settings
+	NumberFormat `yaml:",inline"`
+}
+
+// NumberFormat controls how prices and changes are printed. Unset fields
+// inherit from the global config, then from the locale.
+type NumberFormat struct {
+	// decimals for prices (default 2) and for changes (default 2)
+	Precision       *int `yaml:"precision,omitempty"`
+	ChangePrecision *int `yaml:"change_precision,omitempty"`
+	// separators, e.g. "." and "," for 1.245,50
+	ThousandsSeparator *string `yaml:"thousands_separator,omitempty"`
+	DecimalSeparator   *string `yaml:"decimal_separator,omitempty"`
+	// locale presets the separators (e.g. "es_AR", "en_US", "de_DE")
+	Locale string `yaml:"locale,omitempty"`
+}
+
+// apply layers the fields set in f over n.
+func (f NumberFormat) apply(n formatter.Number) formatter.Number {
+	if f.Locale != "" {
+		n, _ = n.Locale(f.Locale)
+	}
+	if f.Precision != nil {
+		n.Precision = *f.Precision
+	}
+	if f.ChangePrecision != nil {
+		n.ChangePrecision = *f.ChangePrecision
+	}
+	if f.ThousandsSeparator != nil {
+		n.Thousands = *f.ThousandsSeparator
+	}
+	if f.DecimalSeparator != nil {
+		n.Decimal = *f.DecimalSeparator
+	}
+	return n
 }
 
 type Colors struct {
 	Up      string `yaml:"up"`
 	Down    string `yaml:"down"`
 	Neutral string `yaml:"neutral"`
+	// optional colors for moves beyond thresholds.strong (default: up/down)
+	UpStrong   string `yaml:"up_strong,omitempty"`
+	DownStrong string `yaml:"down_strong,omitempty"`
+}
+
+// Thresholds classify the percent change as neutral, weak or strong.
+type Thresholds struct {
+	// |change| below Neutral renders as neutral
+	Neutral float64 `yaml:"neutral"`
+	// |change| at or above Strong uses the *_strong colors and classes
+	Strong float64 `yaml:"strong"`
+	// blend weak moves from up/down towards up_strong/down_strong
+	Gradient bool `yaml:"gradient"`
+}
+
+// Arrows are the markers rendered by {icon} for rising and falling quotes.
+type Arrows struct {
+	Up   string `yaml:"up"`
+	Down string `yaml:"down"`
+}
+
+// Percentage maps the percent change into Waybar's 0–100 "percentage" field:
+// Min maps to 0 and Max to 100.
+type Percentage struct {
+	Min float64 `yaml:"min"`
+	Max float64 `yaml:"max"`
+}
+
+// ProviderSettings configures a provider. API keys can also come from a
+// secret file or the provider's environment variable (e.g. FINNHUB_API_KEY).
+type ProviderSettings struct {
+	APIKey     string `yaml:"api_key"`
+	APIKeyFile string `yaml:"api_key_file"`
+	// let the provider take plain tickers from Yahoo in automatic routing
+	// (finnhub)
+	Route bool `yaml:"route"`
+	// request budget of rate-limited providers (alphavantage); 0 keeps the
+	// provider's default
+	RequestsPerMinute int `yaml:"requests_per_minute"`
+	RequestsPerDay    int `yaml:"requests_per_day"`
+}
+
+// Display modes.
+const (
+	DisplayRotate  = "rotate"  // one asset at a time, rotating on rotation_interval
+	DisplayAll     = "all"     // every asset, joined by Separator
+	DisplayMarquee = "marquee" // a scrolling window over every asset
+)
+
+// Marquee configures the scrolling window of the marquee display mode.
+type Marquee struct {
+	// visible characters
+	Width int `yaml:"width"`
+	// characters to advance on every rotation_interval
+	Step int `yaml:"step"`
+}
+
+// Streaming configures the WebSocket ticker feeds used in daemon mode.
+type Streaming struct {
+	// stream Binance and Coinbase crypto quotes between refreshes
+	Enabled bool `yaml:"enabled"`
+	// minimum seconds between redraws caused by ticks
+	RedrawInterval float64 `yaml:"redraw_interval"`
 }
 
 type Config struct {
-	RefreshInterval  int     `yaml:"refresh_interval"`
-	RotationInterval int     `yaml:"rotation_interval"`
-	Format           string  `yaml:"format"`
-	Assets           []Asset `yaml:"assets"`
-	Colors           Colors  `yaml:"colors"`
+	RefreshInterval  int `yaml:"refresh_interval"`
+	RotationInterval int `yaml:"rotation_interval"`
+	// "rotate" (default), "all" or "marquee"
+	DisplayMode string    `yaml:"display_mode"`
+	Separator   string    `yaml:"separator"`
+	Marquee     Marquee   `yaml:"marquee"`
+	Streaming   Streaming `yaml:"streaming"`
+	Format      string    `yaml:"format"`
+	Assets      []Asset   `yaml:"assets"`
+	Colors      Colors    `yaml:"colors"`
+	// icon and arrows shared by every asset unless overridden
+	Icon   string `yaml:"icon"`
+	Arrows Arrows `yaml:"arrows"`
+	// show the last cached quote (with the "stale" class) when a fetch fails
+	StaleFallback bool       `yaml:"stale_fallback"`
+	Percentage    Percentage `yaml:"percentage"`
+	Thresholds    Thresholds `yaml:"thresholds"`
+	// per-provider settings, keyed by provider name (e.g. "finnhub")
+	Providers map[string]ProviderSettings `yaml:"providers"`
+	// global number formatting, overridable per asset
+	NumberFormat `yaml:",inline"`
+
+	// lines maps key paths to their YAML line, for validation messages
+	lines map[string]int
+	// decodeProblems holds unknown keys and type mismatches found while decoding
+	decodeProblems []Problem
+}
+
+// Number returns the number formatting for asset: the defaults, overridden
+// by the global settings, overridden by the asset's own.
+func (c *Config) Number(asset Asset) formatter.Number {
+	return asset.NumberFormat.apply(c.NumberFormat.apply(formatter.DefaultNumber))
+}
+
+// AssetFormat returns the format of asset, falling back to the global one.
+func (c *Config) AssetFormat(asset Asset) string {
+	return cmp.Or(asset.Format, c.Format)
+}
+
+// Style returns the rendering style of asset: its own colors, icon, arrows
+// and number formatting where set, the global ones otherwise.
+func (c *Config) Style(asset Asset) formatter.Style {
+	return formatter.Style{
+		Colors: formatter.Colors{
+			Up:         cmp.Or(asset.Colors.Up, c.Colors.Up),
+			Down:       cmp.Or(asset.Colors.Down, c.Colors.Down),
+			Neutral:    cmp.Or(asset.Colors.Neutral, c.Colors.Neutral),
+			UpStrong:   cmp.Or(asset.Colors.UpStrong, c.Colors.UpStrong),
+			DownStrong: cmp.Or(asset.Colors.DownStrong, c.Colors.DownStrong),
+		},
+		Number: c.Number(asset),
+		Arrows: formatter.Arrows{
+			Up:   cmp.Or(asset.Arrows.Up, c.Arrows.Up),
+			Down: cmp.Or(asset.Arrows.Down, c.Arrows.Down),
+		},
+		Icon:       cmp.Or(asset.Icon, c.Icon),
+		Thresholds: formatter.Thresholds(c.Thresholds),
+	}
 }
 
+// LoadConfig reads path, applies defaults and validates the result. On
+// validation failure the returned error is a *ValidationError and the
+// config is still returned so callers can inspect it.
 func LoadConfig(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
-	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
+	cfg, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// Parse decodes YAML data and applies defaults without validating.
+func Parse(data []byte) (*Config, error) {
+	cfg := &Config{
+		Percentage: Percentage{Min: -5, Max: 5},
+		Thresholds: Thresholds{Strong: DefaultStrongThreshold},
+		lines:      make(map[string]int),
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
 		return nil, err
 	}
-	return &cfg, nil
+	indexLines(&doc, "", cfg.lines)
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && err != io.EOF {
+		problems, ok := typeErrorProblems(err)
+		if !ok {
+			return nil, err
+		}
+		cfg.decodeProblems = problems
+	}
+	cfg.ApplyDefaults()
+	return cfg, nil
 }
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// EnvConfig names the environment variable that points at the config file.
+const EnvConfig = "WAYBAR_STOCKS_CONFIG"
+
+// DefaultPath is where `waybar-stocks init` writes the config:
+// $XDG_CONFIG_HOME/waybar-stocks/config.yml, or ~/.config/waybar-stocks/config.yml.
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "waybar-stocks", "config.yml"), nil
+}
+
+// Candidates returns the paths searched for the config file, in order:
+// $WAYBAR_STOCKS_CONFIG, $XDG_CONFIG_HOME/waybar-stocks/config.yml,
+// ~/.config/waybar-stocks/config.yml and ./config.yml.
+func Candidates() []string {
+	var paths []string
+	if p := os.Getenv(EnvConfig); p != "" {
+		paths = append(paths, p)
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		paths = append(paths, filepath.Join(dir, "waybar-stocks", "config.yml"))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, ".config", "waybar-stocks", "config.yml"))
+	}
+	return append(paths, "config.yml")
+}
+
+// Find returns the config file to use: flagPath when given (the --config
+// flag), otherwise the first existing candidate.
+func Find(flagPath string) (string, error) {
+	if flagPath != "" {
+		return flagPath, nil
+	}
+	candidates := Candidates()
+	for _, p := range candidates {
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("no config file found (searched %s); create one with `waybar-stocks init`", strings.Join(candidates, ", "))
+}
+
+// ErrExists is returned by WriteStarter when the file exists and force is
+// not set.
+var ErrExists = errors.New("config file already exists")
+
+// WriteStarter writes data to path, creating its directory. An existing
+// file is only replaced when force is set.
+func WriteStarter(path string, data []byte, force bool) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !force {
+		flags |= os.O_EXCL
+	}
+	f, err := os.OpenFile(path, flags, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%s: %w (use --force to overwrite)", path, ErrExists)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
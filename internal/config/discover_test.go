@@ -0,0 +1,56 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFind(t *testing.T) {
+	home, xdg := t.TempDir(), t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+	t.Setenv(EnvConfig, "")
+	t.Chdir(t.TempDir())
+
+	if _, err := Find(""); err == nil {
+		t.Error("no config anywhere: want error")
+	}
+	if got, _ := Find("explicit.yml"); got != "explicit.yml" {
+		t.Errorf("--config: got %q", got)
+	}
+
+	homeConfig := filepath.Join(home, ".config", "waybar-stocks", "config.yml")
+	xdgConfig := filepath.Join(xdg, "waybar-stocks", "config.yml")
+	envConfig := filepath.Join(t.TempDir(), "env.yml")
+	for _, step := range []struct {
+		write string
+		want  string
+	}{
+		{"config.yml", "config.yml"},
+		{homeConfig, homeConfig},
+		{xdgConfig, xdgConfig},
+		{envConfig, envConfig},
+	} {
+		if err := WriteStarter(step.write, []byte("assets: []\n"), false); err != nil {
+			t.Fatal(err)
+		}
+		if step.write == envConfig {
+			t.Setenv(EnvConfig, envConfig)
+		}
+		if got, err := Find(""); err != nil || got != step.want {
+			t.Errorf("after writing %s: Find = %q, %v; want %q", step.write, got, err, step.want)
+		}
+	}
+
+	if err := WriteStarter(xdgConfig, []byte("x"), false); !errors.Is(err, ErrExists) {
+		t.Errorf("WriteStarter over existing file: err = %v, want ErrExists", err)
+	}
+	if err := WriteStarter(xdgConfig, []byte("x"), true); err != nil {
+		t.Errorf("WriteStarter --force: %v", err)
+	}
+	if b, _ := os.ReadFile(xdgConfig); string(b) != "x" {
+		t.Errorf("forced write left %q", b)
+	}
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bautitobal/waybar-stocks/internal/fetcher"
+)
+
+// APIKey returns the key for the provider called name: providers.<name>.api_key,
+// then the contents of providers.<name>.api_key_file, then the environment
+// variable env.
+func (c *Config) APIKey(name, env string) (string, error) {
+	s := c.Providers[name]
+	if s.APIKey != "" {
+		return s.APIKey, nil
+	}
+	if s.APIKeyFile != "" {
+		b, err := os.ReadFile(expandHome(s.APIKeyFile))
+		if err != nil {
+			return "", fmt.Errorf("providers.%s.api_key_file: %w", name, err)
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+	return os.Getenv(env), nil
+}
+
+// Budget returns the request budget for the provider called name: the
+// configured limits, with unset ones taken from def.
+func (c *Config) Budget(name string, def fetcher.Budget) fetcher.Budget {
+	s := c.Providers[name]
+	return fetcher.Budget{
+		PerMinute: cmp.Or(s.RequestsPerMinute, def.PerMinute),
+		PerDay:    cmp.Or(s.RequestsPerDay, def.PerDay),
+	}
+}
+
+// ConfigureProviders hands the configured API keys, routing switches,
+// request budgets and pinned CoinGecko ids to the providers of the fetcher
+// registry.
+func (c *Config) ConfigureProviders() error {
+	ids := make(map[string]string)
+	for _, a := range c.Assets {
+		if a.CoinGeckoID != "" {
+			ids[strings.ToUpper(a.Symbol)] = a.CoinGeckoID
+		}
+	}
+	for _, name := range fetcher.Providers() {
+		p, _ := fetcher.Lookup(name)
+		if rp, ok := p.(fetcher.RoutedProvider); ok {
+			p = rp.WithRouting(c.Providers[name].Route)
+		}
+		if ip, ok := p.(fetcher.IDProvider); ok && name == "coingecko" {
+			p = ip.WithIDs(ids)
+		}
+		if kp, ok := p.(fetcher.KeyedProvider); ok {
+			key, err := c.APIKey(name, kp.KeyEnv())
+			if err != nil {
+				return err
+			}
+			p = kp.WithKey(key)
+		}
+		if bp, ok := p.(fetcher.BudgetedProvider); ok {
+			p = bp.WithBudget(c.Budget(name, bp.DefaultBudget()))
+		}
+		fetcher.Register(p)
+	}
+	return nil
+}
+
+// expandHome replaces a leading "~/" with the home directory.
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bautitobal/waybar-stocks/internal/fetcher"
+)
+
+func TestAPIKey(t *testing.T) {
+	t.Setenv("FINNHUB_API_KEY", "from-env")
+	secret := filepath.Join(t.TempDir(), "finnhub")
+	if err := os.WriteFile(secret, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		settings ProviderSettings
+		want     string
+	}{
+		{ProviderSettings{}, "from-env"},
+		{ProviderSettings{APIKeyFile: secret}, "from-file"},
+		{ProviderSettings{APIKey: "inline", APIKeyFile: secret}, "inline"},
+	} {
+		c := &Config{Providers: map[string]ProviderSettings{"finnhub": tt.settings}}
+		if got, err := c.APIKey("finnhub", "FINNHUB_API_KEY"); err != nil || got != tt.want {
+			t.Errorf("%+v: APIKey = %q, %v; want %q", tt.settings, got, err, tt.want)
+		}
+	}
+
+	cfg, err := Parse([]byte("providers:\n  finnhub:\n    api_key_file: /nonexistent/key\n  nope: {}\nassets:\n  - symbol: AAPL\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	verr, ok := cfg.Validate().(*ValidationError)
+	if !ok || len(verr.Problems) != 2 {
+		t.Fatalf("Validate = %v, want 2 problems", verr)
+	}
+}
+
+func TestBudget(t *testing.T) {
+	cfg, err := Parse([]byte("providers:\n  alphavantage:\n    requests_per_day: 10\nassets:\n  - symbol: IBM\n    provider: alphavantage\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := cfg.Budget("alphavantage", fetcher.Budget{PerMinute: 5, PerDay: 25})
+	if want := (fetcher.Budget{PerMinute: 5, PerDay: 10}); got != want {
+		t.Errorf("Budget = %+v, want %+v", got, want)
+	}
+
+	cfg, err = Parse([]byte("providers:\n  alphavantage:\n    requests_per_minute: -1\nassets:\n  - symbol: IBM\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "providers.alphavantage.requests_per_minute") {
+		t.Errorf("Validate = %v, want a requests_per_minute problem", err)
+	}
+}
+
+func TestCoinGeckoID(t *testing.T) {
+	cfg, err := Parse([]byte("assets:\n  - symbol: MYCOIN-USD\n    coingecko_id: my-coin\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.ConfigureProviders(); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := fetcher.Resolve("", "mycoin-usd"); err != nil || p.Name() != "coingecko" {
+		t.Errorf("pinned symbol routed to %v, %v; want coingecko", p, err)
+	}
+
+	cfg, err = Parse([]byte("assets:\n  - symbol: BTC-USD\n    provider: yahoo\n    coingecko_id: bitcoin\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "coingecko_id") {
+		t.Errorf("Validate = %v, want a coingecko_id problem", err)
+	}
+}
+
+func TestRoute(t *testing.T) {
+	t.Setenv("FINNHUB_API_KEY", "from-env")
+	defer fetcher.Register(fetcher.NewFinnhub("", "", nil))
+	for _, tt := range []struct {
+		doc  string
+		want string
+	}{
+		{"assets:\n  - symbol: AAPL\n", "yahoo"},
+		{"providers:\n  finnhub:\n    route: true\nassets:\n  - symbol: AAPL\n", "finnhub"},
+	} {
+		cfg, err := Parse([]byte(tt.doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := cfg.ConfigureProviders(); err != nil {
+			t.Fatal(err)
+		}
+		if p, err := fetcher.Resolve("", "AAPL"); err != nil || p.Name() != tt.want {
+			t.Errorf("%q: AAPL routed to %v, %v; want %s", tt.doc, p, err, tt.want)
+		}
+	}
+
+	cfg, err := Parse([]byte("providers:\n  yahoo:\n    route: true\nassets:\n  - symbol: AAPL\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "providers.yahoo.route") {
+		t.Errorf("Validate = %v, want a route problem", err)
+	}
+}
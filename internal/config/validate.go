@@ -0,0 +1,353 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bautitobal/waybar-stocks/internal/fetcher"
+	"github.com/bautitobal/waybar-stocks/internal/formatter"
+	"gopkg.in/yaml.v3"
+)
+
+// Documented defaults applied to keys missing from config.yml.
+const (
+	DefaultRefreshInterval  = 60
+	DefaultRotationInterval = 5
+	DefaultFormat           = "{symbol} {price} ({change}%{icon})"
+	DefaultColorUp          = "#00FF00"
+	DefaultColorDown        = "#FF5555"
+	DefaultColorNeutral     = "#FFFFFF"
+	DefaultArrowUp          = "▲"
+	DefaultArrowDown        = "▼"
+	DefaultStrongThreshold  = 3.0
+	DefaultDisplayMode      = DisplayRotate
+	DefaultSeparator        = " | "
+	DefaultMarqueeWidth     = 40
+	DefaultMarqueeStep      = 1
+	DefaultRedrawInterval   = 1.0
+)
+
+// Problem is a single validation failure located by its YAML line
+// (0 when the key is missing from the file).
+type Problem struct {
+	Line    int
+	Field   string
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.Line > 0 {
+		return fmt.Sprintf("line %d: %s: %s", p.Line, p.Field, p.Message)
+	}
+	return fmt.Sprintf("%s: %s", p.Field, p.Message)
+}
+
+// ValidationError reports every problem found in a config file.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		msgs[i] = p.String()
+	}
+	return fmt.Sprintf("%d problem(s) in config:\n  %s", len(e.Problems), strings.Join(msgs, "\n  "))
+}
+
+// ApplyDefaults fills in every key that was not set in the YAML file.
+func (c *Config) ApplyDefaults() {
+	if !c.has("refresh_interval") {
+		c.RefreshInterval = DefaultRefreshInterval
+	}
+	if !c.has("rotation_interval") {
+		c.RotationInterval = DefaultRotationInterval
+	}
+	if !c.has("display_mode") {
+		c.DisplayMode = DefaultDisplayMode
+	}
+	if !c.has("separator") {
+		c.Separator = DefaultSeparator
+	}
+	if !c.has("marquee.width") {
+		c.Marquee.Width = DefaultMarqueeWidth
+	}
+	if !c.has("marquee.step") {
+		c.Marquee.Step = DefaultMarqueeStep
+	}
+	if !c.has("streaming.redraw_interval") {
+		c.Streaming.RedrawInterval = DefaultRedrawInterval
+	}
+	if !c.has("format") {
+		c.Format = DefaultFormat
+	}
+	if !c.has("colors.up") {
+		c.Colors.Up = DefaultColorUp
+	}
+	if !c.has("colors.down") {
+		c.Colors.Down = DefaultColorDown
+	}
+	if !c.has("colors.neutral") {
+		c.Colors.Neutral = DefaultColorNeutral
+	}
+	if !c.has("arrows.up") {
+		c.Arrows.Up = DefaultArrowUp
+	}
+	if !c.has("arrows.down") {
+		c.Arrows.Down = DefaultArrowDown
+	}
+	for i := range c.Assets {
+		if c.Assets[i].Name == "" {
+			c.Assets[i].Name = c.Assets[i].Symbol
+		}
+	}
+}
+
+// Validate checks the config and returns a *ValidationError listing every
+// problem found, or nil.
+func (c *Config) Validate() error {
+	problems := append([]Problem(nil), c.decodeProblems...)
+	add := func(field, format string, args ...interface{}) {
+		problems = append(problems, Problem{Line: c.line(field), Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if c.RefreshInterval <= 0 {
+		add("refresh_interval", "must be a positive number of seconds, got %d", c.RefreshInterval)
+	}
+	if c.RotationInterval <= 0 {
+		add("rotation_interval", "must be a positive number of seconds, got %d", c.RotationInterval)
+	}
+	switch c.DisplayMode {
+	case DisplayRotate, DisplayAll, DisplayMarquee:
+	default:
+		add("display_mode", "unknown display mode %q (use %s, %s or %s)", c.DisplayMode, DisplayRotate, DisplayAll, DisplayMarquee)
+	}
+	if c.Marquee.Width <= 0 {
+		add("marquee.width", "must be a positive number of characters, got %d", c.Marquee.Width)
+	}
+	if c.Marquee.Step <= 0 {
+		add("marquee.step", "must be a positive number of characters, got %d", c.Marquee.Step)
+	}
+	if c.Streaming.RedrawInterval <= 0 {
+		add("streaming.redraw_interval", "must be a positive number of seconds, got %g", c.Streaming.RedrawInterval)
+	}
+	if strings.TrimSpace(c.Format) == "" {
+		add("format", "must not be empty")
+	} else if err := formatter.Check(c.Format); err != nil {
+		add("format", "%v", err)
+	}
+	c.Colors.validate("", false, add)
+	if t := c.Thresholds; t.Neutral < 0 {
+		add("thresholds.neutral", "must not be negative, got %g", t.Neutral)
+	} else if t.Strong <= t.Neutral {
+		add("thresholds.strong", "(%g) must be greater than thresholds.neutral (%g)", t.Strong, t.Neutral)
+	}
+	if c.Thresholds.Gradient {
+		if err := formatter.CheckGradient(formatter.Colors(c.Colors)); err != nil {
+			add("colors", "%v (thresholds.gradient is on)", err)
+		}
+	}
+	if c.Percentage.Max <= c.Percentage.Min {
+		add("percentage", "max (%g) must be greater than min (%g)", c.Percentage.Max, c.Percentage.Min)
+	}
+
+	c.NumberFormat.validate("", add)
+
+	for _, name := range slices.Sorted(maps.Keys(c.Providers)) {
+		field := "providers." + name
+		p, ok := fetcher.Lookup(name)
+		if !ok {
+			add(field, "unknown provider %q (known: %s)", name, strings.Join(fetcher.Providers(), ", "))
+			continue
+		}
+		s := c.Providers[name]
+		if _, ok := p.(fetcher.RoutedProvider); s.Route && !ok {
+			add(field+".route", "%s is always part of automatic routing", name)
+		}
+		if s.APIKey == "" && s.APIKeyFile != "" {
+			if _, err := c.APIKey(name, ""); err != nil {
+				add(field+".api_key_file", "%v", errors.Unwrap(err))
+			}
+		}
+		if s.RequestsPerMinute < 0 {
+			add(field+".requests_per_minute", "must not be negative, got %d", s.RequestsPerMinute)
+		}
+		if s.RequestsPerDay < 0 {
+			add(field+".requests_per_day", "must not be negative, got %d", s.RequestsPerDay)
+		}
+	}
+
+	if len(c.Assets) == 0 {
+		add("assets", "at least one asset is required")
+	}
+	seen := make(map[string]int)
+	for i, a := range c.Assets {
+		prefix := fmt.Sprintf("assets[%d]", i)
+		if strings.TrimSpace(a.Symbol) == "" {
+			add(prefix+".symbol", "is required")
+			continue
+		}
+		// the duration, not the spelling, identifies a timeframe: "15m" is
+		// minutes and "15M" months, while "1D" and "24h" are the same
+		dur, err := fetcher.ParseTimeframe(a.Timeframe)
+		switch {
+		case err != nil:
+			add(prefix+".timeframe", "unknown timeframe %q (examples: 15m, 1H, 1D, 1W, 1M, 1Y)", a.Timeframe)
+		case dur <= 0:
+			add(prefix+".timeframe", "must be a positive timeframe, got %q", a.Timeframe)
+		}
+		if c.has(prefix + ".format") {
+			if strings.TrimSpace(a.Format) == "" {
+				add(prefix+".format", "must not be empty")
+			} else if err := formatter.Check(a.Format); err != nil {
+				add(prefix+".format", "%v", err)
+			}
+		}
+		a.Colors.validate(prefix+".", true, add)
+		if c.Thresholds.Gradient {
+			if err := formatter.CheckGradient(formatter.Colors(a.Colors)); err != nil {
+				add(prefix+".colors", "%v (thresholds.gradient is on)", err)
+			}
+		}
+		a.NumberFormat.validate(prefix+".", add)
+		if a.Provider != "" {
+			if _, ok := fetcher.Lookup(a.Provider); !ok {
+				add(prefix+".provider", "unknown provider %q (known: %s)", a.Provider, strings.Join(fetcher.Providers(), ", "))
+			}
+		}
+		if a.CoinGeckoID != "" && a.Provider != "" && a.Provider != "coingecko" {
+			add(prefix+".coingecko_id", "only used by the coingecko provider (provider is %q)", a.Provider)
+		}
+		key := strings.ToUpper(a.Symbol) + "|" + dur.String()
+		if err != nil {
+			key = strings.ToUpper(a.Symbol) + "|" + a.Timeframe
+		}
+		if first, ok := seen[key]; ok {
+			add(prefix+".symbol", "duplicate asset %s (timeframe %q), already defined as assets[%d]", a.Symbol, a.Timeframe, first)
+		} else {
+			seen[key] = i
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Line < problems[j].Line })
+	return &ValidationError{Problems: problems}
+}
+
+// validate checks the colors. The strong colors, and every color of an
+// asset (optional), may be left empty to inherit.
+func (c Colors) validate(prefix string, optional bool, add func(field, format string, args ...interface{})) {
+	for _, color := range []struct {
+		field, value string
+		optional     bool
+	}{
+		{"colors.up", c.Up, optional},
+		{"colors.down", c.Down, optional},
+		{"colors.neutral", c.Neutral, optional},
+		{"colors.up_strong", c.UpStrong, true},
+		{"colors.down_strong", c.DownStrong, true},
+	} {
+		if color.optional && color.value == "" {
+			continue
+		}
+		if !formatter.IsColor(color.value) {
+			add(prefix+color.field, "invalid color %q (use #RRGGBB or a color name)", color.value)
+		}
+	}
+}
+
+func (f NumberFormat) validate(prefix string, add func(field, format string, args ...interface{})) {
+	for _, p := range []struct {
+		field string
+		value *int
+	}{{"precision", f.Precision}, {"change_precision", f.ChangePrecision}} {
+		if p.value != nil && (*p.value < 0 || *p.value > 12) {
+			add(prefix+p.field, "must be between 0 and 12, got %d", *p.value)
+		}
+	}
+	if f.Locale != "" {
+		if _, ok := formatter.DefaultNumber.Locale(f.Locale); !ok {
+			add(prefix+"locale", "unknown locale %q (known: %s)", f.Locale, strings.Join(formatter.Locales(), ", "))
+		}
+	}
+}
+
+func (c *Config) has(field string) bool {
+	_, ok := c.lines[field]
+	return ok
+}
+
+// line returns the YAML line of field, or of its closest parent.
+func (c *Config) line(field string) int {
+	for field != "" {
+		if l, ok := c.lines[field]; ok {
+			return l
+		}
+		i := strings.LastIndexAny(field, ".[")
+		if i < 0 {
+			break
+		}
+		field = field[:i]
+	}
+	return 0
+}
+
+// indexLines records the line of every key in the document, keyed by
+// paths like "colors.up" or "assets[2].timeframe".
+func indexLines(n *yaml.Node, path string, lines map[string]int) {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		for _, c := range n.Content {
+			indexLines(c, path, lines)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := n.Content[i].Value
+			if path != "" {
+				key = path + "." + key
+			}
+			lines[key] = n.Content[i].Line
+			indexLines(n.Content[i+1], key, lines)
+		}
+	case yaml.SequenceNode:
+		for i, c := range n.Content {
+			key := path + "[" + strconv.Itoa(i) + "]"
+			lines[key] = c.Line
+			indexLines(c, key, lines)
+		}
+	}
+}
+
+// typeErrorProblems converts yaml decode errors ("line 3: field foo not
+// found in type config.Config") into problems.
+func typeErrorProblems(err error) ([]Problem, bool) {
+	var te *yaml.TypeError
+	if !errors.As(err, &te) {
+		return nil, false
+	}
+	problems := make([]Problem, 0, len(te.Errors))
+	for _, msg := range te.Errors {
+		p := Problem{Field: "config", Message: msg}
+		if rest, ok := strings.CutPrefix(msg, "line "); ok {
+			if num, text, ok := strings.Cut(rest, ": "); ok {
+				if l, err := strconv.Atoi(num); err == nil {
+					p.Line, p.Message = l, text
+				}
+			}
+		}
+		if name, ok := strings.CutPrefix(p.Message, "field "); ok {
+			if name, _, ok := strings.Cut(name, " not found"); ok {
+				p.Field, p.Message = name, "unknown key"
+			}
+		}
+		problems = append(problems, p)
+	}
+	return problems, true
+}
@@ -0,0 +1,190 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	doc := `refresh_interval: 0
+display_mode: scroll
+colour: red
+colors:
+  up: "#12345"
+thresholds:
+  neutral: 2
+  strong: 1
+percentage:
+  min: 5
+  max: 5
+marquee:
+  width: -1
+streaming:
+  redraw_interval: 0
+assets:
+  - symbol: AAPL
+    timeframe: 2X
+  - name: nameless
+  - symbol: MSFT
+    provider: nope
+    precision: 13
+  - symbol: msft
+  - symbol: BTC-USD
+    provider: yahoo
+    coingecko_id: bitcoin
+`
+	cfg, err := Parse([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	verr, ok := cfg.Validate().(*ValidationError)
+	if !ok {
+		t.Fatalf("Validate = %v, want a *ValidationError", cfg.Validate())
+	}
+	got := make([]string, len(verr.Problems))
+	for i, p := range verr.Problems {
+		got[i] = p.String()
+	}
+	want := []string{
+		`line 1: refresh_interval: must be a positive number of seconds, got 0`,
+		`line 2: display_mode: unknown display mode "scroll" (use rotate, all or marquee)`,
+		`line 3: colour: unknown key`,
+		`line 5: colors.up: invalid color "#12345" (use #RRGGBB or a color name)`,
+		`line 8: thresholds.strong: (1) must be greater than thresholds.neutral (2)`,
+		`line 9: percentage: max (5) must be greater than min (5)`,
+		`line 13: marquee.width: must be a positive number of characters, got -1`,
+		`line 15: streaming.redraw_interval: must be a positive number of seconds, got 0`,
+		`line 18: assets[0].timeframe: unknown timeframe "2X" (examples: 15m, 1H, 1D, 1W, 1M, 1Y)`,
+		`line 19: assets[1].symbol: is required`,
+		`line 21: assets[2].provider: unknown provider "nope" (known: dolarapi, coingecko, binance, finnhub, alphavantage, yahoo)`,
+		`line 22: assets[2].precision: must be between 0 and 12, got 13`,
+		`line 23: assets[3].symbol: duplicate asset msft (timeframe ""), already defined as assets[2]`,
+		`line 26: assets[4].coingecko_id: only used by the coingecko provider (provider is "yahoo")`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("problems:\n  %s\nwant:\n  %s", strings.Join(got, "\n  "), strings.Join(want, "\n  "))
+	}
+}
+
+func TestValidateTimeframes(t *testing.T) {
+	doc := `assets:
+  - symbol: AAPL
+    timeframe: 15m
+  - symbol: AAPL
+    timeframe: 15M
+  - symbol: MSFT
+    timeframe: -3D
+  - symbol: SPY
+    timeframe: 0D
+  - symbol: BTC-USD
+    timeframe: 1D
+  - symbol: BTC-USD
+    timeframe: 24h
+`
+	cfg, err := Parse([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	verr, ok := cfg.Validate().(*ValidationError)
+	if !ok {
+		t.Fatalf("Validate = %v, want a *ValidationError", cfg.Validate())
+	}
+	got := make([]string, len(verr.Problems))
+	for i, p := range verr.Problems {
+		got[i] = p.String()
+	}
+	// 15m (minutes) and 15M (months) are different assets
+	want := []string{
+		`line 7: assets[2].timeframe: must be a positive timeframe, got "-3D"`,
+		`line 9: assets[3].timeframe: must be a positive timeframe, got "0D"`,
+		`line 12: assets[5].symbol: duplicate asset BTC-USD (timeframe "24h"), already defined as assets[4]`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("problems:\n  %s\nwant:\n  %s", strings.Join(got, "\n  "), strings.Join(want, "\n  "))
+	}
+}
+
+// TestValidateFormatExecution checks that templates which parse but fail to
+// render are reported at their line.
+func TestValidateFormatExecution(t *testing.T) {
+	cfg, err := Parse([]byte("format: \"{{.Nope}}\"\nassets:\n  - symbol: AAPL\n    format: \"{{round .Price}}\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	verr, ok := cfg.Validate().(*ValidationError)
+	if !ok || len(verr.Problems) != 2 {
+		t.Fatalf("Validate = %v, want 2 problems", cfg.Validate())
+	}
+	for i, want := range []string{
+		`line 1: format: template: format:1:2: executing "format" at <.Nope>: can't evaluate field Nope`,
+		`line 4: assets[0].format: template: format:1:2: executing "format" at <round>: wrong number of args`,
+	} {
+		if got := verr.Problems[i].String(); !strings.HasPrefix(got, want) {
+			t.Errorf("problem %d = %q, want prefix %q", i, got, want)
+		}
+	}
+}
+
+func TestValidateMissingAssets(t *testing.T) {
+	cfg, err := Parse([]byte("format: \"\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	verr, ok := cfg.Validate().(*ValidationError)
+	if !ok || len(verr.Problems) != 2 {
+		t.Fatalf("Validate = %v, want 2 problems", cfg.Validate())
+	}
+	// the missing key has no line
+	if p := verr.Problems[0]; p.String() != "assets: at least one asset is required" {
+		t.Errorf("problem = %q", p)
+	}
+	if p := verr.Problems[1]; p.String() != "line 1: format: must not be empty" {
+		t.Errorf("problem = %q", p)
+	}
+}
+
+func TestApplyDefaults(t *testing.T) {
+	cfg, err := Parse([]byte("assets:\n  - symbol: AAPL\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate = %v", err)
+	}
+	for _, tt := range []struct {
+		field     string
+		got, want any
+	}{
+		{"refresh_interval", cfg.RefreshInterval, DefaultRefreshInterval},
+		{"rotation_interval", cfg.RotationInterval, DefaultRotationInterval},
+		{"display_mode", cfg.DisplayMode, DefaultDisplayMode},
+		{"separator", cfg.Separator, DefaultSeparator},
+		{"marquee.width", cfg.Marquee.Width, DefaultMarqueeWidth},
+		{"marquee.step", cfg.Marquee.Step, DefaultMarqueeStep},
+		{"streaming.redraw_interval", cfg.Streaming.RedrawInterval, DefaultRedrawInterval},
+		{"format", cfg.Format, DefaultFormat},
+		{"colors.up", cfg.Colors.Up, DefaultColorUp},
+		{"colors.down", cfg.Colors.Down, DefaultColorDown},
+		{"colors.neutral", cfg.Colors.Neutral, DefaultColorNeutral},
+		{"arrows.up", cfg.Arrows.Up, DefaultArrowUp},
+		{"arrows.down", cfg.Arrows.Down, DefaultArrowDown},
+		{"thresholds.strong", cfg.Thresholds.Strong, DefaultStrongThreshold},
+		{"percentage.min", cfg.Percentage.Min, -5.0},
+		{"percentage.max", cfg.Percentage.Max, 5.0},
+		{"assets[0].name", cfg.Assets[0].Name, "AAPL"},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.field, tt.got, tt.want)
+		}
+	}
+
+	// keys present in the file are kept, even when empty
+	cfg, err = Parse([]byte("separator: \"\"\nassets:\n  - symbol: AAPL\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Separator != "" {
+		t.Errorf("separator = %q, want the configured empty one", cfg.Separator)
+	}
+}
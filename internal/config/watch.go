@@ -0,0 +1,120 @@
+package config
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// watchDebounce coalesces the bursts of events editors produce on save.
+const watchDebounce = 200 * time.Millisecond
+
+// Watch reports changes to the file at path on the returned channel until
+// ctx is cancelled. It uses inotify where available (watching the parent
+// directory, so editors that replace the file are seen) for prompt
+// updates, and polls the modification time and size every poll as a
+// fallback that also covers symlinked configs. A change seen by both is
+// reported once.
+func Watch(ctx context.Context, path string, poll time.Duration) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+	events := watchPoll(ctx, path, poll)
+	if notify, err := watchNotify(ctx, path); err == nil {
+		events = merge(ctx, events, notify)
+	}
+	last := statFile(path)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-events:
+			}
+			// wait for the burst to settle
+			timer := time.NewTimer(watchDebounce)
+		settle:
+			for {
+				select {
+				case <-events:
+					timer.Reset(watchDebounce)
+				case <-timer.C:
+					break settle
+				case <-ctx.Done():
+					timer.Stop()
+					return
+				}
+			}
+			// the other source reporting a change already sent
+			if cur := statFile(path); cur != last {
+				last = cur
+				select {
+				case changes <- struct{}{}:
+				default: // a change is already pending
+				}
+			}
+		}
+	}()
+	return changes
+}
+
+// fileStat is what Watch compares to tell changes apart.
+type fileStat struct {
+	mod  time.Time
+	size int64
+}
+
+// statFile returns the modification time and size of path, with size -1
+// when it does not exist.
+func statFile(path string) fileStat {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStat{size: -1}
+	}
+	return fileStat{info.ModTime(), info.Size()}
+}
+
+// watchPoll sends an event whenever the modification time or size of path
+// changes (including the file appearing or disappearing).
+func watchPoll(ctx context.Context, path string, poll time.Duration) <-chan struct{} {
+	events := make(chan struct{}, 1)
+	last := statFile(path)
+	go func() {
+		ticker := time.NewTicker(poll)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if cur := statFile(path); cur != last {
+				last = cur
+				select {
+				case events <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return events
+}
+
+// merge forwards the events of a and b to one channel.
+func merge(ctx context.Context, a, b <-chan struct{}) <-chan struct{} {
+	out := make(chan struct{}, 1)
+	forward := func(in <-chan struct{}) {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-in:
+			}
+			select {
+			case out <- struct{}{}:
+			default:
+			}
+		}
+	}
+	go forward(a)
+	go forward(b)
+	return out
+}
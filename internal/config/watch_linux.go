@@ -0,0 +1,64 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// watchNotify watches the directory of path with inotify and sends an event
+// whenever an entry named like path is written, created, moved or removed.
+func watchNotify(ctx context.Context, path string) (<-chan struct{}, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_NONBLOCK | syscall.IN_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	const mask = syscall.IN_CLOSE_WRITE | syscall.IN_CREATE | syscall.IN_MOVED_TO | syscall.IN_DELETE | syscall.IN_MOVED_FROM
+	if _, err := syscall.InotifyAddWatch(fd, filepath.Dir(path), mask); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	// a non-blocking fd is served by the runtime poller, so Close unblocks Read
+	f := os.NewFile(uintptr(fd), "inotify")
+	name := filepath.Base(path)
+
+	events := make(chan struct{}, 1)
+	go func() {
+		<-ctx.Done()
+		f.Close()
+	}()
+	go func() {
+		buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+		for {
+			n, err := f.Read(buf)
+			if err != nil {
+				return
+			}
+			for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+				ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+				nameBytes := buf[off+syscall.SizeofInotifyEvent : off+syscall.SizeofInotifyEvent+int(ev.Len)]
+				off += syscall.SizeofInotifyEvent + int(ev.Len)
+				if cString(nameBytes) != name {
+					continue
+				}
+				select {
+				case events <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return events, nil
+}
+
+// cString trims the NUL padding of an inotify event name.
+func cString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
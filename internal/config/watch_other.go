@@ -0,0 +1,13 @@
+//go:build !linux
+
+package config
+
+import (
+	"context"
+	"errors"
+)
+
+// watchNotify is only implemented on Linux; Watch polls elsewhere.
+func watchNotify(ctx context.Context, path string) (<-chan struct{}, error) {
+	return nil, errors.New("inotify not available")
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte("assets: []\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// poll slower than the debounce, so inotify and the poller see the
+	// save separately
+	const poll = 4 * watchDebounce
+	changes := Watch(ctx, path, poll)
+
+	// replace the file the way editors do: write elsewhere, then rename
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte("assets:\n  - symbol: AAPL\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changes:
+	case <-time.After(3 * time.Second):
+		t.Fatal("no change reported")
+	}
+	select {
+	case <-changes:
+		t.Error("one save reported more than once")
+	case <-time.After(2*poll + watchDebounce):
+	}
+}
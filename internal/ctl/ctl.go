@@ -0,0 +1,234 @@
+// Package ctl is the daemon's control API: newline-delimited JSON over a
+// Unix socket. Each connection sends one Request and reads one Response,
+// except "subscribe", which streams every update as a JSON line.
+package ctl
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Subscribe is the command that streams updates instead of replying once.
+const Subscribe = "subscribe"
+
+// Request is one command, e.g. {"cmd": "pin", "args": ["BTC-USD"]}.
+type Request struct {
+	Cmd  string   `json:"cmd"`
+	Args []string `json:"args,omitempty"`
+}
+
+// Response is the reply to a Request.
+type Response struct {
+	OK    bool            `json:"ok"`
+	Error string          `json:"error,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+}
+
+// Reply builds a successful Response carrying v.
+func Reply(v any) Response {
+	if v == nil {
+		return Response{OK: true}
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return Fail(err)
+	}
+	return Response{OK: true, Data: b}
+}
+
+// Fail builds an error Response.
+func Fail(err error) Response {
+	return Response{Error: err.Error()}
+}
+
+// SocketPath returns $XDG_RUNTIME_DIR/waybar-stocks.sock, or a per-user
+// path in the temp dir when XDG_RUNTIME_DIR is unset.
+func SocketPath() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "waybar-stocks.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("waybar-stocks-%d.sock", os.Getuid()))
+}
+
+// Handler answers every command but subscribe. It is called from the
+// connection's goroutine.
+type Handler func(Request) Response
+
+// Server accepts control connections and fans published updates out to
+// subscribers.
+type Server struct {
+	ln     net.Listener
+	handle Handler
+
+	mu   sync.Mutex
+	subs map[chan []byte]struct{}
+	last []byte // latest update, sent first to new subscribers
+}
+
+// Listen creates the socket at path. A leftover socket from a dead daemon
+// is replaced; a live one is an error.
+func Listen(path string, h Handler) (*Server, error) {
+	if c, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		c.Close()
+		return nil, fmt.Errorf("%s: another daemon is already listening", path)
+	}
+	os.Remove(path)
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return &Server{ln: ln, handle: h, subs: make(map[chan []byte]struct{})}, nil
+}
+
+// Serve accepts connections until Close.
+func (s *Server) Serve() {
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.serve(c)
+	}
+}
+
+// Close stops accepting connections and removes the socket.
+func (s *Server) Close() error {
+	return s.ln.Close() // also unlinks the socket file
+}
+
+// Subscribers returns the number of connected subscribers.
+func (s *Server) Subscribers() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.subs)
+}
+
+// Publish sends v to every subscriber as one JSON line. Subscribers that
+// fall behind miss updates rather than blocking the daemon.
+func (s *Server) Publish(v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last = b
+	for ch := range s.subs {
+		select {
+		case ch <- b:
+		default:
+		}
+	}
+}
+
+func (s *Server) serve(c net.Conn) {
+	defer c.Close()
+	var req Request
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err := json.NewDecoder(c).Decode(&req); err != nil {
+		json.NewEncoder(c).Encode(Fail(fmt.Errorf("invalid request: %v", err)))
+		return
+	}
+	c.SetReadDeadline(time.Time{})
+	if req.Cmd == Subscribe {
+		s.subscribe(c)
+		return
+	}
+	json.NewEncoder(c).Encode(s.handle(req))
+}
+
+// subscribe streams updates to c until the client goes away.
+func (s *Server) subscribe(c net.Conn) {
+	ch := make(chan []byte, 8)
+	s.mu.Lock()
+	s.subs[ch] = struct{}{}
+	if s.last != nil {
+		ch <- s.last
+	}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.subs, ch)
+		s.mu.Unlock()
+	}()
+
+	// the client never writes again, so a read returns once it hangs up
+	gone := make(chan struct{})
+	go func() {
+		c.Read(make([]byte, 1))
+		close(gone)
+	}()
+	for {
+		select {
+		case b := <-ch:
+			if _, err := c.Write(append(b, '\n')); err != nil {
+				return
+			}
+		case <-gone:
+			return
+		}
+	}
+}
+
+// Call sends req to the daemon listening on path and returns its Response.
+func Call(path string, req Request) (Response, error) {
+	c, err := dial(path)
+	if err != nil {
+		return Response{}, err
+	}
+	defer c.Close()
+	if err := json.NewEncoder(c).Encode(req); err != nil {
+		return Response{}, err
+	}
+	var resp Response
+	if err := json.NewDecoder(c).Decode(&resp); err != nil {
+		return Response{}, fmt.Errorf("reading response: %v", err)
+	}
+	if !resp.OK {
+		return resp, errors.New(resp.Error)
+	}
+	return resp, nil
+}
+
+// Stream subscribes to the daemon listening on path and calls fn with every
+// update (a Waybar JSON object) until fn fails or the daemon goes away.
+func Stream(path string, fn func(line []byte) error) error {
+	c, err := dial(path)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if err := json.NewEncoder(c).Encode(Request{Cmd: Subscribe}); err != nil {
+		return err
+	}
+	sc := bufio.NewScanner(c)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		if err := fn(sc.Bytes()); err != nil {
+			return err
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	return errors.New("daemon closed the connection")
+}
+
+func dial(path string) (net.Conn, error) {
+	c, err := net.DialTimeout("unix", path, 2*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("no daemon listening on %s (start one with --daemon): %v", path, err)
+	}
+	return c, nil
+}
@@ -0,0 +1,66 @@
+package ctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCallAndStream(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.sock")
+	srv, err := Listen(path, func(req Request) Response {
+		if req.Cmd == "echo" {
+			return Reply(req.Args)
+		}
+		return Fail(fmt.Errorf("unknown command %q", req.Cmd))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	go srv.Serve()
+
+	if _, err := Listen(path, nil); err == nil {
+		t.Error("second Listen on a live socket: want error")
+	}
+
+	resp, err := Call(path, Request{Cmd: "echo", Args: []string{"a", "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp.Data) != `["a","b"]` {
+		t.Errorf("echo data = %s", resp.Data)
+	}
+	if _, err := Call(path, Request{Cmd: "nope"}); err == nil {
+		t.Error("unknown command: want error")
+	}
+
+	srv.Publish(map[string]string{"text": "first"})
+	lines := make(chan string)
+	go Stream(path, func(line []byte) error {
+		lines <- string(line)
+		return nil
+	})
+	// a new subscriber gets the latest update right away
+	if got := <-lines; got != `{"text":"first"}` {
+		t.Errorf("first line = %s", got)
+	}
+	for srv.Subscribers() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	srv.Publish(map[string]string{"text": "second"})
+	var out map[string]string
+	if err := json.Unmarshal([]byte(<-lines), &out); err != nil || out["text"] != "second" {
+		t.Errorf("second line = %v, %v", out, err)
+	}
+}
+
+func TestCallWithoutDaemon(t *testing.T) {
+	_, err := Call(filepath.Join(t.TempDir(), "none.sock"), Request{Cmd: "status"})
+	if err == nil || !strings.Contains(err.Error(), "no daemon listening") {
+		t.Errorf("err = %v, want no daemon listening", err)
+	}
+}
@@ -0,0 +1,347 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// alphaVantageBudget is the free tier: 25 requests a day, and a few per
+// minute. The daily quota is shared by every asset using the provider.
+var alphaVantageBudget = Budget{PerMinute: 5, PerDay: 25}
+
+// alphaVantageFX matches currency pairs: "EUR/USD", "USD-ARS" or Yahoo's
+// "EURUSD=X".
+var alphaVantageFX = regexp.MustCompile(`^([A-Za-z]{3})[/-]([A-Za-z]{3})$|^([A-Za-z]{3})([A-Za-z]{3})=X$`)
+
+// alphaVantagePoint is one daily close.
+type alphaVantagePoint struct {
+	Date  time.Time `json:"date"`
+	Close float64   `json:"close"`
+}
+
+// alphaVantageCache is the state persisted in the cache dir, so one-shot
+// runs spend no more requests than the daemon.
+type alphaVantageCache struct {
+	// Series are daily closes by query, reused for the UTC day they were
+	// downloaded on: past closes do not change, and every download costs a
+	// request
+	Series map[string]alphaVantageSeries `json:"series"`
+	// Rates are the last FX rates seen by pair, standing in for the previous
+	// close of the daily change
+	Rates map[string]alphaVantageRate `json:"rates"`
+}
+
+type alphaVantageSeries struct {
+	Day    string              `json:"day"` // UTC date of the download
+	Points []alphaVantagePoint `json:"points"`
+}
+
+type alphaVantageRate struct {
+	Day  string  `json:"day"` // UTC date of Rate
+	Rate float64 `json:"rate"`
+	// Prev is the last rate seen on an earlier day
+	Prev float64 `json:"prev"`
+}
+
+var alphaVantageMutex sync.Mutex
+
+func alphaVantageCachePath() string {
+	return filepath.Join(CacheDir(), "alphavantage_cache.json")
+}
+
+// loadAlphaVantageCache reads the persisted cache. The caller holds
+// alphaVantageMutex.
+func loadAlphaVantageCache() *alphaVantageCache {
+	var c alphaVantageCache
+	if b, err := os.ReadFile(alphaVantageCachePath()); err == nil {
+		json.Unmarshal(b, &c)
+	}
+	if c.Series == nil {
+		c.Series = make(map[string]alphaVantageSeries)
+	}
+	if c.Rates == nil {
+		c.Rates = make(map[string]alphaVantageRate)
+	}
+	return &c
+}
+
+// updateAlphaVantageCache runs fn on the persisted cache and saves it.
+// Write errors are ignored: the data is downloaded again next time.
+func updateAlphaVantageCache(fn func(c *alphaVantageCache)) {
+	alphaVantageMutex.Lock()
+	defer alphaVantageMutex.Unlock()
+	c := loadAlphaVantageCache()
+	fn(c)
+	path := alphaVantageCachePath()
+	b, err := json.Marshal(c)
+	if err != nil {
+		return
+	}
+	tmp := path + ".tmp"
+	if os.WriteFile(tmp, b, 0o644) == nil {
+		os.Rename(tmp, path)
+	}
+}
+
+// alphaVantageProvider fetches stock quotes and FX rates from
+// https://www.alphavantage.co. It needs an API key and is only used by
+// assets that select it with `provider: alphavantage`.
+type alphaVantageProvider struct {
+	httpEndpoint
+	apiKey string
+	budget Budget
+}
+
+// NewAlphaVantage returns the Alpha Vantage provider using apiKey. Empty
+// baseURL and nil client select the public API and a default client.
+func NewAlphaVantage(baseURL, apiKey string, client *http.Client) Provider {
+	return &alphaVantageProvider{
+		httpEndpoint: newHTTPEndpoint(baseURL, "https://www.alphavantage.co", client, 10*time.Second),
+		apiKey:       apiKey,
+		budget:       alphaVantageBudget,
+	}
+}
+
+func (p *alphaVantageProvider) Name() string { return "alphavantage" }
+
+// KeyEnv is read when no API key is configured.
+func (p *alphaVantageProvider) KeyEnv() string { return "ALPHAVANTAGE_API_KEY" }
+
+// WithKey returns the provider using key.
+func (p *alphaVantageProvider) WithKey(key string) Provider {
+	c := *p
+	c.apiKey = key
+	return &c
+}
+
+// DefaultBudget is the free tier's quota.
+func (p *alphaVantageProvider) DefaultBudget() Budget { return alphaVantageBudget }
+
+// WithBudget returns the provider limited by b.
+func (p *alphaVantageProvider) WithBudget(b Budget) Provider {
+	c := *p
+	c.budget = b
+	return &c
+}
+
+// MinInterval spreads the daily budget over the assets, keeping one request
+// per asset and day (up to half the budget) for the daily series. One asset
+// on the free tier is refreshed hourly.
+func (p *alphaVantageProvider) MinInterval(assets int) time.Duration {
+	if p.budget.PerDay <= 0 || assets <= 0 {
+		return 0
+	}
+	quotes := max(p.budget.PerDay-assets, (p.budget.PerDay+1)/2)
+	return 24 * time.Hour * time.Duration(assets) / time.Duration(quotes)
+}
+
+// Supports is always false: with its small quota the provider is only used
+// when an asset asks for it.
+func (p *alphaVantageProvider) Supports(symbol string) bool { return false }
+
+// Fetch uses GLOBAL_QUOTE for stocks and CURRENCY_EXCHANGE_RATE for FX
+// pairs. The change over timeframes other than a day comes from the
+// TIME_SERIES_DAILY (or FX_DAILY) closes. The daily change of FX pairs is
+// relative to the last rate seen on an earlier day, as DolarApi does.
+func (p *alphaVantageProvider) Fetch(ctx context.Context, symbol, timeframe string) (*Quote, error) {
+	if p.apiKey == "" {
+		return nil, fmt.Errorf("alphavantage: no API key (set providers.alphavantage.api_key, api_key_file or $%s)", p.KeyEnv())
+	}
+	symbol = strings.ToUpper(symbol)
+
+	var dur time.Duration
+	tf := strings.TrimSpace(strings.ToUpper(timeframe))
+	if tf != "" && tf != "D" && tf != "1D" {
+		// parse the original string: upper-casing turns minutes ("15m") into months ("15M")
+		if d, err := ParseTimeframe(timeframe); err == nil && d > 24*time.Hour {
+			dur = d
+		}
+	}
+
+	if m := alphaVantageFX.FindStringSubmatch(symbol); m != nil {
+		from, to := m[1]+m[3], m[2]+m[4]
+		return p.fetchFX(ctx, symbol, from, to, dur)
+	}
+	return p.fetchStock(ctx, symbol, dur)
+}
+
+func (p *alphaVantageProvider) fetchStock(ctx context.Context, symbol string, dur time.Duration) (*Quote, error) {
+	var data map[string]string
+	if err := p.call(ctx, url.Values{"function": {"GLOBAL_QUOTE"}, "symbol": {symbol}}, "Global Quote", &data); err != nil {
+		return nil, fmt.Errorf("alphavantage %s: %v", symbol, err)
+	}
+	price, err := parseNumber(data["05. price"])
+	if err != nil || price == 0 {
+		return nil, fmt.Errorf("alphavantage: no quote for %s (unknown symbol?)", symbol)
+	}
+	q := &Quote{Symbol: symbol, Price: price}
+	for key, dst := range map[string]*float64{"02. open": &q.Open, "03. high": &q.High, "04. low": &q.Low, "06. volume": &q.Volume} {
+		if v, err := parseNumber(data[key]); err == nil {
+			*dst = v
+		}
+	}
+	if day, err := time.Parse(time.DateOnly, data["07. latest trading day"]); err == nil {
+		q.Time = day
+	}
+
+	if dur == 0 {
+		if prev, err := parseNumber(data["08. previous close"]); err == nil {
+			q.setReference(prev)
+		} else if pct, err := parseNumber(strings.TrimSuffix(data["10. change percent"], "%")); err == nil {
+			q.setChangePercent(pct)
+		}
+		return q, nil
+	}
+	points, err := p.daily(ctx, url.Values{"function": {"TIME_SERIES_DAILY"}, "symbol": {symbol}}, "Time Series (Daily)")
+	if err != nil {
+		return nil, fmt.Errorf("alphavantage %s daily series: %v", symbol, err)
+	}
+	q.setReference(referenceClose(points, dur))
+	return q, nil
+}
+
+func (p *alphaVantageProvider) fetchFX(ctx context.Context, symbol, from, to string, dur time.Duration) (*Quote, error) {
+	var data map[string]string
+	params := url.Values{"function": {"CURRENCY_EXCHANGE_RATE"}, "from_currency": {from}, "to_currency": {to}}
+	if err := p.call(ctx, params, "Realtime Currency Exchange Rate", &data); err != nil {
+		return nil, fmt.Errorf("alphavantage %s: %v", symbol, err)
+	}
+	rate, err := parseNumber(data["5. Exchange Rate"])
+	if err != nil || rate == 0 {
+		return nil, fmt.Errorf("alphavantage: no exchange rate for %s", symbol)
+	}
+	q := &Quote{Symbol: symbol, Price: rate, Currency: to}
+	if v, err := parseNumber(data["8. Bid Price"]); err == nil {
+		q.Bid = v
+	}
+	if v, err := parseNumber(data["9. Ask Price"]); err == nil {
+		q.Ask = v
+	}
+	if t, err := time.Parse(time.DateTime, data["6. Last Refreshed"]); err == nil {
+		q.Time = t
+	}
+
+	if dur == 0 {
+		// FX_DAILY would cost a second request on every refresh
+		pair, day := from+to, time.Now().UTC().Format(time.DateOnly)
+		updateAlphaVantageCache(func(c *alphaVantageCache) {
+			r := c.Rates[pair]
+			if r.Day != day {
+				r.Prev, r.Day = r.Rate, day
+			}
+			r.Rate = rate
+			c.Rates[pair] = r
+			q.setReference(r.Prev)
+		})
+		return q, nil
+	}
+	points, err := p.daily(ctx, url.Values{"function": {"FX_DAILY"}, "from_symbol": {from}, "to_symbol": {to}}, "Time Series FX (Daily)")
+	if err != nil {
+		return nil, fmt.Errorf("alphavantage %s daily series: %v", symbol, err)
+	}
+	q.setReference(referenceClose(points, dur))
+	return q, nil
+}
+
+// daily returns the daily closes listed under key, reusing the download of
+// the same UTC day.
+func (p *alphaVantageProvider) daily(ctx context.Context, params url.Values, key string) ([]alphaVantagePoint, error) {
+	id, day := params.Encode(), time.Now().UTC().Format(time.DateOnly)
+	alphaVantageMutex.Lock()
+	s := loadAlphaVantageCache().Series[id]
+	alphaVantageMutex.Unlock()
+	if s.Day == day && len(s.Points) > 0 {
+		return s.Points, nil
+	}
+
+	var data map[string]map[string]string
+	if err := p.call(ctx, params, key, &data); err != nil {
+		return nil, err
+	}
+	points := make([]alphaVantagePoint, 0, len(data))
+	for day, v := range data {
+		date, err := time.Parse(time.DateOnly, day)
+		if err != nil {
+			continue
+		}
+		if c, err := parseNumber(v["4. close"]); err == nil {
+			points = append(points, alphaVantagePoint{date, c})
+		}
+	}
+	if len(points) == 0 {
+		return nil, errors.New("no data")
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Date.Before(points[j].Date) })
+
+	updateAlphaVantageCache(func(c *alphaVantageCache) {
+		c.Series[id] = alphaVantageSeries{Day: day, Points: points}
+	})
+	return points, nil
+}
+
+// referenceClose returns the last close at or before "last point - dur", or
+// the first one when the series does not reach that far back.
+func referenceClose(points []alphaVantagePoint, dur time.Duration) float64 {
+	target := points[len(points)-1].Date.Add(-dur)
+	for i := len(points) - 1; i >= 0; i-- {
+		if !points[i].Date.After(target) {
+			return points[i].Close
+		}
+	}
+	return points[0].Close
+}
+
+// call spends one request of the budget on the query params and decodes the
+// object under key into v. Alpha Vantage reports errors and exhausted
+// quotas with HTTP 200 and a "Error Message", "Note" or "Information" field.
+func (p *alphaVantageProvider) call(ctx context.Context, params url.Values, key string, v any) error {
+	if err := p.budget.take(p.Name(), time.Now()); err != nil {
+		return err
+	}
+	query := maps.Clone(params)
+	query.Set("apikey", p.apiKey)
+	resp, err := p.get(ctx, "/query?"+query.Encode(), nil)
+	if err != nil {
+		// the key travels in the URL, keep it out of logs and tooltips
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			ue.URL = strings.ReplaceAll(ue.URL, url.QueryEscape(p.apiKey), "REDACTED")
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("error parsing JSON: %v", err)
+	}
+	for _, field := range []string{"Error Message", "Note", "Information"} {
+		if raw, ok := body[field]; ok {
+			var msg string
+			json.Unmarshal(raw, &msg)
+			return errors.New(msg)
+		}
+	}
+	raw, ok := body[key]
+	if !ok {
+		return fmt.Errorf("response has no %q", key)
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("error parsing %q: %v", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// binanceQuoteAssets are the quote assets recognised in pairs written
+// without a separator ("BTCUSDT", "SOLARS"), longest first.
+var binanceQuoteAssets = []string{"FDUSD", "USDT", "USDC", "BUSD", "TUSD", "ARS", "BRL", "EUR", "TRY", "BTC", "ETH", "BNB"}
+
+// binancePair matches a spot pair: "USDT/ARS", "BTC-USDT" or "BTCUSDT".
+var binancePair = regexp.MustCompile(`^([A-Za-z0-9]{2,10})[/-]?([A-Za-z0-9]{2,6})$`)
+
+// binanceTicker is one /api/v3/ticker/24hr entry. Binance sends prices as
+// strings.
+type binanceTicker struct {
+	Symbol             string     `json:"symbol"`
+	LastPrice          flexNumber `json:"lastPrice"`
+	PriceChangePercent flexNumber `json:"priceChangePercent"`
+	OpenPrice          flexNumber `json:"openPrice"`
+	HighPrice          flexNumber `json:"highPrice"`
+	LowPrice           flexNumber `json:"lowPrice"`
+	Volume             flexNumber `json:"volume"`
+	BidPrice           flexNumber `json:"bidPrice"`
+	AskPrice           flexNumber `json:"askPrice"`
+	CloseTime          int64      `json:"closeTime"` // ms
+}
+
+// binanceError is the body of failed requests, e.g. {"code":-1121,"msg":"Invalid symbol."}.
+type binanceError struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+func (e *binanceError) Error() string { return fmt.Sprintf("%s (code %d)", e.Msg, e.Code) }
+
+// binanceInvalidSymbol is the error code for unknown pairs.
+const binanceInvalidSymbol = -1121
+
+// binanceProvider fetches spot pairs from the public Binance REST API.
+type binanceProvider struct {
+	httpEndpoint
+}
+
+// NewBinance returns the Binance provider. Empty baseURL and nil client
+// select the public API and a default client.
+func NewBinance(baseURL string, client *http.Client) Provider {
+	return &binanceProvider{newHTTPEndpoint(baseURL, "https://api.binance.com", client, 10*time.Second)}
+}
+
+func (p *binanceProvider) Name() string { return "binance" }
+
+// Supports matches pairs written without a separator or with a slash
+// ("BTCUSDT", "USDT/ARS") whose quote asset is a common Binance one.
+// Dashed pairs ("BTC-USD") are Yahoo and CoinGecko symbols, but can be
+// fetched from Binance with `provider: binance`.
+func (p *binanceProvider) Supports(symbol string) bool {
+	if strings.Contains(symbol, "-") {
+		return false
+	}
+	_, _, ok := binanceSplit(symbol)
+	return ok
+}
+
+// binanceSplit splits symbol into its base and quote assets. Pairs without
+// a separator need a known quote asset and a base of at least three
+// characters, so plain stock tickers are not mistaken for pairs.
+func binanceSplit(symbol string) (base, quote string, ok bool) {
+	m := binancePair.FindStringSubmatch(strings.ToUpper(symbol))
+	if m == nil {
+		return "", "", false
+	}
+	if strings.ContainsAny(symbol, "/-") {
+		return m[1], m[2], true
+	}
+	pair := m[1] + m[2]
+	for _, q := range binanceQuoteAssets {
+		if b, found := strings.CutSuffix(pair, q); found && len(b) >= 3 {
+			return b, q, true
+		}
+	}
+	return "", "", false
+}
+
+// binanceSymbol returns the API symbol of a pair ("USDT/ARS" → "USDTARS").
+func binanceSymbol(symbol string) string {
+	if base, quote, ok := binanceSplit(symbol); ok {
+		return base + quote
+	}
+	return strings.ToUpper(strings.NewReplacer("/", "", "-", "").Replace(symbol))
+}
+
+// Fetch uses the rolling 24h ticker for the daily change and the open of
+// the kline starting a timeframe ago for other timeframes.
+func (p *binanceProvider) Fetch(ctx context.Context, symbol, timeframe string) (*Quote, error) {
+	var t binanceTicker
+	if err := p.call(ctx, "/api/v3/ticker/24hr?symbol="+url.QueryEscape(binanceSymbol(symbol)), &t); err != nil {
+		return nil, fmt.Errorf("binance %s: %w", symbol, err)
+	}
+	q, err := t.quote(symbol)
+	if err != nil || p.CanBatch(timeframe) {
+		return q, err
+	}
+
+	// parse the original string: upper-casing turns minutes ("15m") into months ("15M")
+	dur, err := ParseTimeframe(timeframe)
+	if err != nil {
+		return q, nil
+	}
+	start := time.Now().Add(-dur)
+	path := fmt.Sprintf("/api/v3/klines?symbol=%s&interval=%s&startTime=%d&limit=1",
+		url.QueryEscape(binanceSymbol(symbol)), binanceInterval(dur), start.UnixMilli())
+	// each kline is [openTime, open, high, low, close, volume, closeTime, ...]
+	var klines [][]json.RawMessage
+	if err := p.call(ctx, path, &klines); err != nil {
+		return nil, fmt.Errorf("binance %s klines: %w", symbol, err)
+	}
+	if len(klines) == 0 || len(klines[0]) < 2 {
+		return nil, fmt.Errorf("binance: no klines for %s over %s", symbol, timeframe)
+	}
+	var open flexNumber
+	if err := json.Unmarshal(klines[0][1], &open); err != nil || !open.Valid {
+		return nil, fmt.Errorf("binance: malformed kline for %s", symbol)
+	}
+	q.Change, q.AbsChange, q.Reference = 0, 0, 0
+	q.setReference(open.Value)
+	return q, nil
+}
+
+// CanBatch reports whether timeframe is served by the 24h ticker, which
+// accepts several symbols at once.
+func (p *binanceProvider) CanBatch(timeframe string) bool {
+	tf := strings.TrimSpace(strings.ToUpper(timeframe))
+	return tf == "" || tf == "24H" || tf == "1D" || tf == "D"
+}
+
+// FetchBatch fetches the 24h tickers of all symbols with a single request.
+// Binance rejects the whole request when one pair is unknown; the pairs
+// are then fetched one by one so the others still succeed.
+func (p *binanceProvider) FetchBatch(ctx context.Context, symbols []string) (map[string]Result, error) {
+	bySymbol := make(map[string]string, len(symbols))
+	pairs := make([]string, 0, len(symbols))
+	for _, symbol := range symbols {
+		s := binanceSymbol(symbol)
+		bySymbol[s] = symbol
+		pairs = append(pairs, s)
+	}
+	list, err := json.Marshal(pairs)
+	if err != nil {
+		return nil, err
+	}
+	var tickers []binanceTicker
+	err = p.call(ctx, "/api/v3/ticker/24hr?symbols="+url.QueryEscape(string(list)), &tickers)
+	var be *binanceError
+	if errors.As(err, &be) && be.Code == binanceInvalidSymbol {
+		results := make(map[string]Result, len(symbols))
+		for _, symbol := range symbols {
+			q, err := p.Fetch(ctx, symbol, "")
+			results[symbol] = Result{Quote: q, Err: err}
+		}
+		return results, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("binance: %w", err)
+	}
+	results := make(map[string]Result, len(tickers))
+	for _, t := range tickers {
+		symbol, ok := bySymbol[t.Symbol]
+		if !ok {
+			continue
+		}
+		q, err := t.quote(symbol)
+		results[symbol] = Result{Quote: q, Err: err}
+	}
+	return results, nil
+}
+
+// quote converts t into a Quote using the rolling 24h change.
+func (t *binanceTicker) quote(symbol string) (*Quote, error) {
+	if !t.LastPrice.Valid {
+		return nil, fmt.Errorf("binance response for %s is missing lastPrice", symbol)
+	}
+	q := &Quote{
+		Symbol: strings.ToUpper(symbol),
+		Price:  t.LastPrice.Value,
+		// crypto markets never close
+		MarketState: "REGULAR",
+	}
+	if _, quote, ok := binanceSplit(symbol); ok {
+		q.Currency = quote
+	}
+	if t.OpenPrice.Valid {
+		q.setReference(t.OpenPrice.Value)
+	} else if t.PriceChangePercent.Valid {
+		q.setChangePercent(t.PriceChangePercent.Value)
+	}
+	for _, f := range []struct {
+		dst *float64
+		src flexNumber
+	}{
+		{&q.High, t.HighPrice},
+		{&q.Low, t.LowPrice},
+		{&q.Volume, t.Volume},
+		{&q.Bid, t.BidPrice},
+		{&q.Ask, t.AskPrice},
+	} {
+		if f.src.Valid {
+			*f.dst = f.src.Value
+		}
+	}
+	if t.CloseTime > 0 {
+		q.Time = time.UnixMilli(t.CloseTime)
+	}
+	return q, nil
+}
+
+// call GETs path and decodes the JSON response into v.
+func (p *binanceProvider) call(ctx context.Context, path string, v any) error {
+	resp, err := p.get(ctx, path, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusTooManyRequests, http.StatusTeapot:
+		// 418 means the IP was banned for ignoring 429s
+		return fmt.Errorf("HTTP %d: rate limit exceeded", resp.StatusCode)
+	default:
+		var be binanceError
+		if json.NewDecoder(resp.Body).Decode(&be) == nil && be.Msg != "" {
+			return &be
+		}
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("error parsing JSON: %v", err)
+	}
+	return nil
+}
+
+// binanceInterval picks the kline interval for a timeframe: fine enough
+// that the kline opening a timeframe ago starts close to it.
+func binanceInterval(dur time.Duration) string {
+	switch {
+	case dur <= time.Hour:
+		return "1m"
+	case dur <= 24*time.Hour:
+		return "15m"
+	case dur <= 7*24*time.Hour:
+		return "1h"
+	case dur <= 31*24*time.Hour:
+		return "4h"
+	case dur <= 366*24*time.Hour:
+		return "1d"
+	}
+	return "1w"
+}
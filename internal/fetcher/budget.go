@@ -0,0 +1,75 @@
+package fetcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Budget caps the requests a provider sends. It is persisted in the cache
+// dir, so one-shot runs and the daemon share it. Zero fields mean no limit.
+type Budget struct {
+	PerMinute int
+	PerDay    int
+}
+
+// budgetUsage is the persisted request log of one provider.
+type budgetUsage struct {
+	Day    string      `json:"day"` // UTC date the count applies to
+	Count  int         `json:"count"`
+	Recent []time.Time `json:"recent"` // requests in the last minute
+}
+
+var budgetMutex sync.Mutex
+
+func budgetPath(provider string) string {
+	return filepath.Join(CacheDir(), provider+"_budget.json")
+}
+
+// take records one request for provider, or fails without recording it when
+// the budget is spent.
+func (b Budget) take(provider string, now time.Time) error {
+	budgetMutex.Lock()
+	defer budgetMutex.Unlock()
+
+	var u budgetUsage
+	path := budgetPath(provider)
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &u)
+	}
+	day := now.UTC().Format("2006-01-02")
+	if u.Day != day {
+		u = budgetUsage{Day: day}
+	}
+	recent := u.Recent[:0]
+	for _, t := range u.Recent {
+		if now.Sub(t) < time.Minute {
+			recent = append(recent, t)
+		}
+	}
+	u.Recent = recent
+
+	if b.PerDay > 0 && u.Count >= b.PerDay {
+		return fmt.Errorf("%s: daily request budget of %d spent, resets at 00:00 UTC", provider, b.PerDay)
+	}
+	if b.PerMinute > 0 && len(u.Recent) >= b.PerMinute {
+		wait := time.Minute - now.Sub(u.Recent[0])
+		return fmt.Errorf("%s: request budget of %d per minute spent, retry in %s", provider, b.PerMinute, wait.Round(time.Second))
+	}
+	u.Count++
+	u.Recent = append(u.Recent, now)
+
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	// a failed write only loses bookkeeping; the request may still go out
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err == nil {
+		os.Rename(tmp, path)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package fetcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheDir returns $XDG_CACHE_HOME/waybar-stocks (or the platform
+// equivalent), creating it if needed. Falls back to the current directory.
+func CacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil || dir == "" {
+		dir = "."
+	}
+	dir = filepath.Join(dir, "waybar-stocks")
+	_ = os.MkdirAll(dir, 0o755)
+	return dir
+}
+
+// fetchRetry is how long a failed fetch is not retried, unless the TTL is
+// shorter. The failure is persisted, so one-shot runs started every second
+// back off as well.
+const fetchRetry = 30 * time.Second
+
+// cacheEntry is a quote as stored on disk, with the time it was fetched,
+// and the last failed fetch since then, if any.
+type cacheEntry struct {
+	Quote     Quote     `json:"quote"`
+	FetchedAt time.Time `json:"fetched_at"` // zero if no fetch succeeded yet
+	Err       string    `json:"error,omitempty"`
+	FailedAt  time.Time `json:"failed_at,omitzero"`
+}
+
+// updated is when e last changed.
+func (e cacheEntry) updated() time.Time {
+	if e.FailedAt.After(e.FetchedAt) {
+		return e.FailedAt
+	}
+	return e.FetchedAt
+}
+
+// backoff returns the last failure while it is too recent to retry with
+// ttl, or nil.
+func (e cacheEntry) backoff(ttl time.Duration) error {
+	retry := min(ttl, fetchRetry)
+	if e.Err == "" || !fresh(e.FailedAt, retry) {
+		return nil
+	}
+	wait := retry - time.Since(e.FailedAt)
+	return fmt.Errorf("%s (retrying in %s)", e.Err, wait.Round(time.Second))
+}
+
+// quoteCache is the on-disk quote cache shared by every invocation. It is
+// re-read whenever the file changes so concurrent processes see each
+// other's fetches.
+type quoteCache struct {
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+	entries map[string]cacheEntry
+}
+
+var quotes = &quoteCache{}
+
+// cacheKey keeps the timeframe's case: "15m" (minutes) and "15M" (months)
+// are different quotes.
+func cacheKey(provider, symbol, timeframe string) string {
+	return provider + "|" + symbol + "|" + strings.TrimSpace(timeframe)
+}
+
+// load refreshes entries from disk if the file changed. Caller holds mu.
+func (c *quoteCache) load() {
+	if c.path == "" {
+		c.path = filepath.Join(CacheDir(), "quotes.json")
+	}
+	if c.entries == nil {
+		c.entries = make(map[string]cacheEntry)
+	}
+	info, err := os.Stat(c.path)
+	if err != nil || info.ModTime().Equal(c.modTime) {
+		return
+	}
+	b, err := os.ReadFile(c.path)
+	if err != nil {
+		return
+	}
+	var m map[string]cacheEntry
+	if err := json.Unmarshal(b, &m); err != nil {
+		return
+	}
+	for k, e := range m {
+		if old, ok := c.entries[k]; !ok || e.updated().After(old.updated()) {
+			c.entries[k] = e
+		}
+	}
+	c.modTime = info.ModTime()
+}
+
+// fresh reports whether a quote fetched at fetchedAt can be served with ttl.
+// Quotes within a tenth of ttl of expiring already count as expired, so a
+// caller refreshing every ttl never finds its previous quote still fresh.
+func fresh(fetchedAt time.Time, ttl time.Duration) bool {
+	return time.Since(fetchedAt) < ttl-ttl/10
+}
+
+func (c *quoteCache) get(key string) (cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.load()
+	e, ok := c.entries[key]
+	return e, ok
+}
+
+// put stores the outcome of results by key, stamped with their FetchedAt,
+// and writes the cache atomically so readers never see a partially written
+// file. A failure keeps the entry's last quote.
+func (c *quoteCache) put(results map[string]Result) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.load()
+	for key, r := range results {
+		if r.Err != nil {
+			e := c.entries[key]
+			e.Err, e.FailedAt = r.Err.Error(), r.FetchedAt
+			c.entries[key] = e
+			continue
+		}
+		c.entries[key] = cacheEntry{Quote: *r.Quote, FetchedAt: r.FetchedAt}
+	}
+
+	b, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), "quotes-*.json")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if info, err := os.Stat(c.path); err == nil {
+		c.modTime = info.ModTime()
+	}
+	return nil
+}
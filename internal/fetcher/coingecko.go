@@ -0,0 +1,281 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// coinGeckoIDs maps well-known symbols to CoinGecko coin ids, for when the
+// coin list cannot be downloaded.
+var coinGeckoIDs = map[string]string{
+	"BTC-USD": "bitcoin",
+	"ETH-USD": "ethereum",
+	"SOL-USD": "solana",
+}
+
+// coinGeckoMarket is one entry of the coins/markets payload. Nullable
+// values are pointers so a missing field is distinguishable from zero.
+type coinGeckoMarket struct {
+	ID                       string   `json:"id"`
+	Symbol                   string   `json:"symbol"`
+	Name                     string   `json:"name"`
+	CurrentPrice             *float64 `json:"current_price"`
+	PriceChange24h           *float64 `json:"price_change_24h"`
+	PriceChangePercentage24h *float64 `json:"price_change_percentage_24h"`
+	High24h                  *float64 `json:"high_24h"`
+	Low24h                   *float64 `json:"low_24h"`
+	TotalVolume              *float64 `json:"total_volume"`
+	MarketCap                *float64 `json:"market_cap"`
+	LastUpdated              string   `json:"last_updated"`
+}
+
+// coinGeckoMarketChart is the coins/{id}/market_chart payload; each price
+// is a [timestamp_ms, price] pair.
+type coinGeckoMarketChart struct {
+	Prices [][]*float64 `json:"prices"`
+}
+
+// quote converts m, priced in vs, into a Quote using the 24h change.
+func (m *coinGeckoMarket) quote(symbol, vs string) (*Quote, error) {
+	if m.CurrentPrice == nil {
+		return nil, fmt.Errorf("CoinGecko response for %s is missing current_price", m.ID)
+	}
+	q := &Quote{
+		Symbol:   symbol,
+		Price:    *m.CurrentPrice,
+		Currency: strings.ToUpper(vs),
+		// crypto markets never close
+		MarketState: "REGULAR",
+	}
+	if m.PriceChangePercentage24h != nil {
+		q.setChangePercent(*m.PriceChangePercentage24h)
+	}
+	if m.PriceChange24h != nil {
+		q.AbsChange = *m.PriceChange24h
+		q.Reference = q.Price - q.AbsChange
+	}
+	if t, err := time.Parse(time.RFC3339, m.LastUpdated); err == nil {
+		q.Time = t
+	}
+	for _, f := range []struct {
+		dst *float64
+		src *float64
+	}{
+		{&q.High, m.High24h},
+		{&q.Low, m.Low24h},
+		{&q.Volume, m.TotalVolume},
+	} {
+		if f.src != nil {
+			*f.dst = *f.src
+		}
+	}
+	return q, nil
+}
+
+// coinGeckoProvider fetches cryptocurrencies from the CoinGecko API.
+// Symbols are resolved to coin ids through CoinGecko's coin list (see
+// coingecko_ids.go).
+type coinGeckoProvider struct {
+	httpEndpoint
+	// ids pins symbols (upper-cased) to coin ids, from coingecko_id
+	ids      map[string]string
+	resolver *coinGeckoResolver
+}
+
+// NewCoinGecko returns the CoinGecko provider. Empty baseURL and nil client
+// select the public API and a default client.
+func NewCoinGecko(baseURL string, client *http.Client) Provider {
+	return &coinGeckoProvider{
+		httpEndpoint: newHTTPEndpoint(baseURL, "https://api.coingecko.com/api/v3", client, 10*time.Second),
+		resolver:     new(coinGeckoResolver),
+	}
+}
+
+func (p *coinGeckoProvider) Name() string { return "coingecko" }
+
+// WithIDs returns the provider resolving the symbols in ids to the given
+// coin ids.
+func (p *coinGeckoProvider) WithIDs(ids map[string]string) Provider {
+	c := *p
+	c.ids = make(map[string]string, len(ids))
+	for symbol, id := range ids {
+		c.ids[strings.ToUpper(symbol)] = id
+	}
+	return &c
+}
+
+// Supports matches pinned and built-in symbols, well-known coins by id or
+// name, alone or paired with a vs currency ("bitcoin", "shiba-inu-ars"),
+// and coinGeckoPair. It never touches the coin list: whether the coin
+// exists is only known when fetching.
+func (p *coinGeckoProvider) Supports(symbol string) bool {
+	key := strings.ToUpper(strings.TrimSpace(symbol))
+	if _, ok := p.ids[key]; ok {
+		return true
+	}
+	if _, ok := coinGeckoIDs[key]; ok {
+		return true
+	}
+	if coinGeckoPair.MatchString(key) {
+		return true
+	}
+	coin := strings.ToLower(key)
+	if m := coinGeckoPairVs.FindStringIndex(coin); m != nil {
+		if _, ok := coinGeckoKnown[coin[:m[0]]]; ok {
+			return true
+		}
+	}
+	_, ok := coinGeckoKnown[coin]
+	return ok
+}
+
+func (p *coinGeckoProvider) Fetch(ctx context.Context, symbol, timeframe string) (*Quote, error) {
+	id, vs, err := p.resolve(ctx, symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	// For timeframe-aware crypto data we use CoinGecko market endpoints
+	// First, get current market data
+	data, err := p.markets(ctx, vs, []string{id})
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("no data for %s", symbol)
+	}
+	q, err := data[0].quote(symbol, vs)
+	if err != nil {
+		return nil, err
+	}
+
+	// If timeframe is empty or 24h, use the provided 24h field
+	tf := strings.TrimSpace(strings.ToUpper(timeframe))
+	if p.CanBatch(tf) {
+		return q, nil
+	}
+
+	// otherwise, try to compute from market_chart (days param)
+	// parse the original string: upper-casing turns minutes ("15m") into months ("15M")
+	dur, err := ParseTimeframe(timeframe)
+	if err != nil {
+		q.Change, q.AbsChange, q.Reference = 0, 0, 0
+		return q, nil
+	}
+	// CoinGecko market_chart accepts days as float; we pass at least 1
+	days := int((dur + 23*time.Hour) / (24 * time.Hour))
+	if days < 1 {
+		days = 1
+	}
+	resp2, err := p.get(ctx, fmt.Sprintf("/coins/%s/market_chart?vs_currency=%s&days=%d", id, vs, days), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp2.Body.Close()
+	if resp2.StatusCode != 200 {
+		return nil, fmt.Errorf("HTTP %d fetching market_chart for %s", resp2.StatusCode, id)
+	}
+	var chart coinGeckoMarketChart
+	if err := json.NewDecoder(resp2.Body).Decode(&chart); err != nil {
+		return nil, fmt.Errorf("error parsing CoinGecko market_chart for %s: %v", id, err)
+	}
+	// market_chart.Prices: [ [ts_ms, price], ... ]; skip malformed or null points
+	points := make([][2]float64, 0, len(chart.Prices))
+	for _, p := range chart.Prices {
+		if len(p) >= 2 && p[0] != nil && p[1] != nil {
+			points = append(points, [2]float64{*p[0], *p[1]})
+		}
+	}
+	if len(points) == 0 {
+		q.Change, q.AbsChange, q.Reference = 0, 0, 0
+		return q, nil
+	}
+	// find last price and target timestamp
+	last := points[len(points)-1]
+	lastTs := int64(last[0]) / 1000
+	lastPrice := last[1]
+	targetTs := lastTs - int64(dur.Seconds())
+	// find nearest earlier price
+	var prevPrice float64
+	for i := len(points) - 1; i >= 0; i-- {
+		p := points[i]
+		ts := int64(p[0]) / 1000
+		if ts <= targetTs {
+			prevPrice = p[1]
+			break
+		}
+	}
+	if prevPrice == 0 {
+		prevPrice = points[0][1]
+	}
+	q.Price = lastPrice
+	q.Change, q.AbsChange, q.Reference = 0, 0, 0
+	q.setReference(prevPrice)
+	return q, nil
+}
+
+// CanBatch reports whether timeframe is served by the 24h change of the
+// coins/markets endpoint, which accepts several ids at once.
+func (p *coinGeckoProvider) CanBatch(timeframe string) bool {
+	tf := strings.TrimSpace(strings.ToUpper(timeframe))
+	return tf == "" || tf == "24H" || tf == "1D" || tf == "D"
+}
+
+// FetchBatch fetches the 24h quotes of all symbols with one coins/markets
+// call per vs currency. Symbols that cannot be resolved get their own error.
+func (p *coinGeckoProvider) FetchBatch(ctx context.Context, symbols []string) (map[string]Result, error) {
+	results := make(map[string]Result, len(symbols))
+	// vs currency → coin id → symbols asking for it
+	byVs := make(map[string]map[string][]string)
+	for _, symbol := range symbols {
+		id, vs, err := p.resolve(ctx, symbol)
+		if err != nil {
+			results[symbol] = Result{Err: err}
+			continue
+		}
+		if byVs[vs] == nil {
+			byVs[vs] = make(map[string][]string)
+		}
+		byVs[vs][id] = append(byVs[vs][id], symbol)
+	}
+	for _, vs := range slices.Sorted(maps.Keys(byVs)) {
+		bySymbol := byVs[vs]
+		data, err := p.markets(ctx, vs, slices.Sorted(maps.Keys(bySymbol)))
+		if err != nil {
+			return nil, err
+		}
+		for _, coin := range data {
+			for _, symbol := range bySymbol[coin.ID] {
+				q, err := coin.quote(symbol, vs)
+				results[symbol] = Result{Quote: q, Err: err}
+			}
+		}
+	}
+	return results, nil
+}
+
+// markets calls coins/markets for ids, priced in vs.
+func (p *coinGeckoProvider) markets(ctx context.Context, vs string, ids []string) ([]coinGeckoMarket, error) {
+	resp, err := p.get(ctx, "/coins/markets?vs_currency="+url.QueryEscape(vs)+"&ids="+strings.Join(ids, ","), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("HTTP %d fetching %s from CoinGecko", resp.StatusCode, strings.Join(ids, ","))
+	}
+
+	var data []coinGeckoMarket
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("error parsing CoinGecko markets JSON: %v", err)
+	}
+	return data, nil
+}
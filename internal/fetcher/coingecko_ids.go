@@ -0,0 +1,326 @@
+package fetcher
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// coinGeckoListTTL is how long the downloaded coin list is used before it
+// is refreshed.
+const coinGeckoListTTL = 7 * 24 * time.Hour
+
+// coinGeckoRetry is how long a failed list download is not retried. The
+// failure is persisted, so one-shot runs back off as well.
+const coinGeckoRetry = 5 * time.Minute
+
+// coinGeckoPair matches pairs of a ticker and a common vs currency
+// ("BTC-EUR", "eth-ars"), which are routed to CoinGecko without the coin
+// list.
+var coinGeckoPair = regexp.MustCompile(`(?i)^[A-Z0-9]{2,10}-` + coinGeckoVs + `$`)
+
+// coinGeckoKnown maps the ids and names of well-known coins, lower-cased,
+// to their ids. Only these are routed to CoinGecko by id or name; other
+// lowercase symbols ("aapl", "btcusdt") are left to the other providers,
+// and any other coin is reached with provider: coingecko.
+var coinGeckoKnown = map[string]string{
+	"bitcoin":          "bitcoin",
+	"ethereum":         "ethereum",
+	"tether":           "tether",
+	"binancecoin":      "binancecoin",
+	"solana":           "solana",
+	"usd-coin":         "usd-coin",
+	"usd coin":         "usd-coin",
+	"ripple":           "ripple",
+	"dogecoin":         "dogecoin",
+	"cardano":          "cardano",
+	"tron":             "tron",
+	"avalanche-2":      "avalanche-2",
+	"avalanche":        "avalanche-2",
+	"chainlink":        "chainlink",
+	"polkadot":         "polkadot",
+	"shiba-inu":        "shiba-inu",
+	"shiba inu":        "shiba-inu",
+	"litecoin":         "litecoin",
+	"bitcoin-cash":     "bitcoin-cash",
+	"bitcoin cash":     "bitcoin-cash",
+	"stellar":          "stellar",
+	"monero":           "monero",
+	"uniswap":          "uniswap",
+	"ethereum-classic": "ethereum-classic",
+	"ethereum classic": "ethereum-classic",
+	"cosmos":           "cosmos",
+	"the-open-network": "the-open-network",
+	"toncoin":          "the-open-network",
+}
+
+// coinGeckoVs lists the common vs currencies recognized without the coin
+// list.
+const coinGeckoVs = `(USD|EUR|GBP|JPY|CHF|CAD|AUD|NZD|CNY|HKD|SGD|KRW|INR|ARS|BRL|CLP|MXN|TRY|ZAR|PLN|SEK|NOK|DKK|BTC|ETH)`
+
+// coinGeckoPairVs captures the vs currency of a pair, in any case.
+var coinGeckoPairVs = regexp.MustCompile(`(?i)-` + coinGeckoVs + `$`)
+
+// coinGeckoCoin is one /coins/list entry.
+type coinGeckoCoin struct {
+	ID     string `json:"id"`
+	Symbol string `json:"symbol"`
+	Name   string `json:"name"`
+}
+
+// coinGeckoList is CoinGecko's coin list and vs currencies as cached on
+// disk, with the indexes used to resolve symbols.
+type coinGeckoList struct {
+	FetchedAt    time.Time       `json:"fetched_at"`
+	Coins        []coinGeckoCoin `json:"coins"`
+	VsCurrencies []string        `json:"vs_currencies"`
+	// Resolved remembers which coin won the market cap tie-break of a
+	// ticker shared by several coins
+	Resolved map[string]string `json:"resolved,omitempty"`
+
+	ids      map[string]bool
+	bySymbol map[string][]string
+	byName   map[string]string
+	vs       map[string]bool
+}
+
+// index builds the lookup maps of l.
+func (l *coinGeckoList) index() {
+	l.ids = make(map[string]bool, len(l.Coins))
+	l.bySymbol = make(map[string][]string, len(l.Coins))
+	l.byName = make(map[string]string, len(l.Coins))
+	for _, c := range l.Coins {
+		l.ids[c.ID] = true
+		sym := strings.ToLower(c.Symbol)
+		l.bySymbol[sym] = append(l.bySymbol[sym], c.ID)
+		if name := strings.ToLower(c.Name); l.byName[name] == "" {
+			l.byName[name] = c.ID
+		}
+	}
+	l.vs = make(map[string]bool, len(l.VsCurrencies))
+	for _, v := range l.VsCurrencies {
+		l.vs[strings.ToLower(v)] = true
+	}
+	if l.Resolved == nil {
+		l.Resolved = make(map[string]string)
+	}
+}
+
+// lookup splits symbol into a coin and a vs currency: "bitcoin" (an id or
+// name, in USD), "BTC-EUR" (a ticker and a vs currency), "shiba-inu-ars"
+// (an id and a vs currency) or a bare ticker "BTC" (in USD). The coin is an
+// id when byID is set, and a lowercase ticker otherwise.
+func (l *coinGeckoList) lookup(symbol string) (coin, vs string, byID, ok bool) {
+	s := strings.ToLower(strings.TrimSpace(symbol))
+	if l.ids[s] {
+		return s, "usd", true, true
+	}
+	if id := l.byName[s]; id != "" {
+		return id, "usd", true, true
+	}
+	if i := strings.LastIndexByte(s, '-'); i > 0 && l.vs[s[i+1:]] {
+		base, vs := s[:i], s[i+1:]
+		if l.ids[base] {
+			return base, vs, true, true
+		}
+		if len(l.bySymbol[base]) > 0 {
+			return base, vs, false, true
+		}
+	}
+	if len(l.bySymbol[s]) > 0 {
+		return s, "usd", false, true
+	}
+	return "", "", false, false
+}
+
+// coinGeckoResolver downloads and caches the coin list. It is shared by
+// every copy of a provider.
+type coinGeckoResolver struct {
+	mu       sync.Mutex
+	list     *coinGeckoList
+	failedAt time.Time
+}
+
+func coinGeckoListPath() string {
+	return filepath.Join(CacheDir(), "coingecko_coins.json")
+}
+
+// coinGeckoFailedPath is touched when a list download fails; its mtime is
+// the time of the failure.
+func coinGeckoFailedPath() string {
+	return filepath.Join(CacheDir(), "coingecko_coins.failed")
+}
+
+// coinList returns the coin list, downloading it when the cached one is
+// missing or older than coinGeckoListTTL. A stale list is still used when
+// the download fails.
+func (p *coinGeckoProvider) coinList(ctx context.Context) (*coinGeckoList, error) {
+	r := p.resolver
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.list == nil {
+		if b, err := os.ReadFile(coinGeckoListPath()); err == nil {
+			var l coinGeckoList
+			if json.Unmarshal(b, &l) == nil && len(l.Coins) > 0 {
+				l.index()
+				r.list = &l
+			}
+		}
+	}
+	if r.list != nil && time.Since(r.list.FetchedAt) < coinGeckoListTTL {
+		return r.list, nil
+	}
+	if r.failedAt.IsZero() {
+		if fi, err := os.Stat(coinGeckoFailedPath()); err == nil {
+			r.failedAt = fi.ModTime()
+		}
+	}
+	if wait := coinGeckoRetry - time.Since(r.failedAt); wait > 0 {
+		if r.list != nil {
+			return r.list, nil
+		}
+		return nil, fmt.Errorf("CoinGecko coin list unavailable, retrying in %s", wait.Round(time.Second))
+	}
+
+	l, err := p.downloadList(ctx)
+	if err != nil {
+		r.failedAt = time.Now()
+		os.WriteFile(coinGeckoFailedPath(), nil, 0o644)
+		if r.list != nil {
+			return r.list, nil
+		}
+		return nil, err
+	}
+	r.failedAt = time.Time{}
+	os.Remove(coinGeckoFailedPath())
+	l.index()
+	r.list = l
+	saveCoinGeckoList(l)
+	return l, nil
+}
+
+// downloadList fetches /coins/list and /simple/supported_vs_currencies.
+func (p *coinGeckoProvider) downloadList(ctx context.Context) (*coinGeckoList, error) {
+	l := &coinGeckoList{FetchedAt: time.Now()}
+	for _, c := range []struct {
+		path string
+		v    any
+	}{
+		{"/coins/list", &l.Coins},
+		{"/simple/supported_vs_currencies", &l.VsCurrencies},
+	} {
+		resp, err := p.get(ctx, c.path, nil)
+		if err != nil {
+			return nil, err
+		}
+		err = nil
+		if resp.StatusCode != 200 {
+			err = fmt.Errorf("HTTP %d fetching CoinGecko %s", resp.StatusCode, c.path)
+		} else if derr := json.NewDecoder(resp.Body).Decode(c.v); derr != nil {
+			err = fmt.Errorf("error parsing CoinGecko %s: %v", c.path, derr)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(l.Coins) == 0 {
+		return nil, fmt.Errorf("CoinGecko returned an empty coin list")
+	}
+	return l, nil
+}
+
+// saveCoinGeckoList writes l to the cache dir atomically. Errors are
+// ignored: the list is downloaded again next time.
+func saveCoinGeckoList(l *coinGeckoList) {
+	b, err := json.Marshal(l)
+	if err != nil {
+		return
+	}
+	path := coinGeckoListPath()
+	tmp := path + ".tmp"
+	if os.WriteFile(tmp, b, 0o644) == nil {
+		os.Rename(tmp, path)
+	}
+}
+
+// resolve returns the coin id and vs currency of symbol: a pinned id (see
+// WithIDs), a built-in symbol, or the coin list's match, preferring the
+// largest market cap when several coins share a ticker. Only the last
+// needs the coin list.
+func (p *coinGeckoProvider) resolve(ctx context.Context, symbol string) (id, vs string, err error) {
+	key := strings.ToUpper(symbol)
+	if id, ok := p.ids[key]; ok {
+		// the vs currency still comes from a pair's suffix: "BTC-EUR" → eur
+		vs := "usd"
+		if m := coinGeckoPairVs.FindStringSubmatch(key); m != nil {
+			vs = strings.ToLower(m[1])
+		}
+		return id, vs, nil
+	}
+	if id, ok := coinGeckoIDs[key]; ok {
+		return id, "usd", nil
+	}
+	l, err := p.coinList(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	coin, vs, byID, ok := l.lookup(symbol)
+	if !ok {
+		return "", "", fmt.Errorf("crypto %s not found on CoinGecko (set coingecko_id to pick the coin)", symbol)
+	}
+	if byID {
+		return coin, vs, nil
+	}
+	id, err = p.byMarketCap(ctx, l, coin)
+	return id, vs, err
+}
+
+// byMarketCap picks the coin with the largest market cap among those
+// using ticker, remembering the choice with the coin list.
+func (p *coinGeckoProvider) byMarketCap(ctx context.Context, l *coinGeckoList, ticker string) (string, error) {
+	ids := l.bySymbol[ticker]
+	if len(ids) == 1 {
+		return ids[0], nil
+	}
+	p.resolver.mu.Lock()
+	id, ok := l.Resolved[ticker]
+	p.resolver.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	candidates := slices.Sorted(slices.Values(ids))
+	// one page of coins/markets holds up to 250 coins
+	candidates = candidates[:min(len(candidates), 250)]
+	data, err := p.markets(ctx, "usd", candidates)
+	if err != nil {
+		return "", err
+	}
+	best := slices.MaxFunc(append(data, coinGeckoMarket{}), func(a, b coinGeckoMarket) int {
+		return cmp.Compare(marketCap(a), marketCap(b))
+	})
+	if best.ID == "" {
+		return "", fmt.Errorf("no CoinGecko market data for %s", strings.ToUpper(ticker))
+	}
+	p.resolver.mu.Lock()
+	l.Resolved[ticker] = best.ID
+	saveCoinGeckoList(l)
+	p.resolver.mu.Unlock()
+	return best.ID, nil
+}
+
+func marketCap(m coinGeckoMarket) float64 {
+	if m.MarketCap == nil {
+		return -1
+	}
+	return *m.MarketCap
+}
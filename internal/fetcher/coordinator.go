@@ -0,0 +1,216 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// BatchProvider is implemented by providers that can fetch several symbols
+// with a single request.
+type BatchProvider interface {
+	Provider
+	// CanBatch reports whether quotes for timeframe can be batched.
+	CanBatch(timeframe string) bool
+	// FetchBatch returns the quote, or the error, of each symbol keyed by
+	// symbol. Symbols missing from the result are reported as failed.
+	FetchBatch(ctx context.Context, symbols []string) (map[string]Result, error)
+}
+
+// PacedProvider is implemented by providers whose daily quota cannot keep
+// up with the refresh interval. Their quotes are cached for longer instead.
+type PacedProvider interface {
+	Provider
+	// MinInterval is the shortest time between two fetches of one asset
+	// when assets assets use the provider.
+	MinInterval(assets int) time.Duration
+}
+
+// Request identifies one asset to fetch.
+type Request struct {
+	Provider  string // optional, overrides automatic routing
+	Symbol    string
+	Timeframe string
+}
+
+// Result is the outcome of one Request.
+type Result struct {
+	Quote     *Quote
+	FetchedAt time.Time // when the request was sent (earlier if Quote is cached)
+	Err       error
+}
+
+// FetchOptions tunes FetchAll. Zero values select the defaults.
+type FetchOptions struct {
+	TTL         time.Duration // serve cached quotes younger than TTL
+	Workers     int           // concurrent requests overall (default 4)
+	PerProvider int           // concurrent requests per provider (default 2)
+	Timeout     time.Duration // deadline for the whole run (default 20s)
+}
+
+// job is one network request: a single symbol, or a batch of symbols
+// sharing a BatchProvider.
+type job struct {
+	provider Provider
+	indexes  []int
+}
+
+// FetchAll fetches every request concurrently and returns one Result per
+// request, in order. Fresh cached quotes are served without a request,
+// batchable requests are merged, and a failure only affects its own
+// results. Failures are cached too: the request is not retried for
+// fetchRetry (or the TTL, if shorter), and reports the same error meanwhile.
+func FetchAll(ctx context.Context, reqs []Request, opts FetchOptions) []Result {
+	if opts.Workers <= 0 {
+		opts.Workers = 4
+	}
+	if opts.PerProvider <= 0 {
+		opts.PerProvider = 2
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 20 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	results := make([]Result, len(reqs))
+	providers := make([]Provider, len(reqs))
+	assets := make(map[string]int) // provider name -> requests routed to it
+	for i, r := range reqs {
+		p, err := Resolve(r.Provider, r.Symbol)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		providers[i] = p
+		assets[p.Name()]++
+	}
+
+	var jobs []job
+	batches := make(map[string]int) // provider name -> index in jobs
+	for i, r := range reqs {
+		p := providers[i]
+		if p == nil {
+			continue
+		}
+		ttl := opts.TTL
+		if pp, ok := p.(PacedProvider); ok {
+			ttl = max(ttl, pp.MinInterval(assets[p.Name()]))
+		}
+		if e, ok := quotes.get(cacheKey(p.Name(), r.Symbol, r.Timeframe)); ok {
+			if !e.FetchedAt.IsZero() && fresh(e.FetchedAt, ttl) {
+				q := e.Quote
+				results[i].Quote, results[i].FetchedAt = &q, e.FetchedAt
+				continue
+			}
+			if err := e.backoff(ttl); err != nil {
+				results[i].Err = err
+				continue
+			}
+		}
+		if bp, ok := p.(BatchProvider); ok && bp.CanBatch(r.Timeframe) {
+			if b, ok := batches[p.Name()]; ok {
+				jobs[b].indexes = append(jobs[b].indexes, i)
+				continue
+			}
+			batches[p.Name()] = len(jobs)
+		}
+		jobs = append(jobs, job{provider: p, indexes: []int{i}})
+	}
+
+	workers := make(chan struct{}, opts.Workers)
+	perProvider := make(map[string]chan struct{})
+	for _, j := range jobs {
+		if _, ok := perProvider[j.provider.Name()]; !ok {
+			perProvider[j.provider.Name()] = make(chan struct{}, opts.PerProvider)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, j := range jobs {
+		wg.Add(1)
+		go func(j job) {
+			defer wg.Done()
+			// take the provider's slot first: jobs queued behind a busy
+			// provider must not hold workers other providers could use
+			limit := perProvider[j.provider.Name()]
+			select {
+			case limit <- struct{}{}:
+			case <-ctx.Done():
+				setErr(results, j.indexes, ctx.Err())
+				return
+			}
+			defer func() { <-limit }()
+			select {
+			case workers <- struct{}{}:
+			case <-ctx.Done():
+				setErr(results, j.indexes, ctx.Err())
+				return
+			}
+			defer func() { <-workers }()
+			runJob(ctx, j, reqs, results)
+		}(j)
+	}
+	wg.Wait()
+
+	fetched := make(map[string]Result)
+	for _, j := range jobs {
+		for _, i := range j.indexes {
+			r := results[i]
+			// requests that were never sent, or cut short by shutting
+			// down, are retried next time
+			sent := !r.FetchedAt.IsZero() && !errors.Is(r.Err, context.Canceled)
+			if (r.Err == nil && r.Quote != nil) || (r.Err != nil && sent) {
+				fetched[cacheKey(j.provider.Name(), reqs[i].Symbol, reqs[i].Timeframe)] = r
+			}
+		}
+	}
+	if len(fetched) > 0 {
+		if err := quotes.put(fetched); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: could not save quote cache: %v\n", err)
+		}
+	}
+	return results
+}
+
+// runJob performs j and stores its outcome in results. Quotes are stamped
+// with the time the request was sent, so their age measures the refresh
+// interval rather than the interval minus the request's latency. Jobs write
+// disjoint indexes, so no locking is needed.
+func runJob(ctx context.Context, j job, reqs []Request, results []Result) {
+	sent := time.Now()
+	if bp, ok := j.provider.(BatchProvider); ok && len(j.indexes) > 1 {
+		symbols := make([]string, len(j.indexes))
+		for k, i := range j.indexes {
+			symbols[k] = reqs[i].Symbol
+		}
+		got, err := bp.FetchBatch(ctx, symbols)
+		for _, i := range j.indexes {
+			results[i].FetchedAt = sent
+		}
+		if err != nil {
+			setErr(results, j.indexes, err)
+			return
+		}
+		for _, i := range j.indexes {
+			if r, ok := got[reqs[i].Symbol]; ok {
+				results[i].Quote, results[i].Err = r.Quote, r.Err
+			} else {
+				results[i].Err = fmt.Errorf("no data for %s", reqs[i].Symbol)
+			}
+		}
+		return
+	}
+	i := j.indexes[0]
+	results[i].Quote, results[i].Err = j.provider.Fetch(ctx, reqs[i].Symbol, reqs[i].Timeframe)
+	results[i].FetchedAt = sent
+}
+
+func setErr(results []Result, indexes []int, err error) {
+	for _, i := range indexes {
+		results[i].Err = err
+	}
+}
@@ -0,0 +1,110 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// dolarAPIQuote is the /v1/dolares/{casa} payload.
+type dolarAPIQuote struct {
+	Moneda             string     `json:"moneda"`
+	Casa               string     `json:"casa"`
+	Nombre             string     `json:"nombre"`
+	Compra             flexNumber `json:"compra"`
+	Venta              flexNumber `json:"venta"`
+	FechaActualizacion string     `json:"fechaActualizacion"`
+}
+
+// dolarAPIProvider fetches Argentine dollar quotations from https://dolarapi.com
+type dolarAPIProvider struct {
+	httpEndpoint
+}
+
+// NewDolarAPI returns the DolarApi provider. Empty baseURL and nil client
+// select the public API and a default client.
+func NewDolarAPI(baseURL string, client *http.Client) Provider {
+	return &dolarAPIProvider{newHTTPEndpoint(baseURL, "https://dolarapi.com/v1", client, 8*time.Second)}
+}
+
+func (p *dolarAPIProvider) Name() string { return "dolarapi" }
+
+// Supports matches the special "dolar-*" symbols (e.g. "dolar-oficial", "dolar-blue").
+func (p *dolarAPIProvider) Supports(symbol string) bool {
+	return strings.HasPrefix(strings.ToLower(symbol), "dolar-")
+}
+
+func (p *dolarAPIProvider) Fetch(ctx context.Context, symbol, timeframe string) (*Quote, error) {
+	// map common symbol names to API endpoints
+	m := map[string]string{
+		"dolar-oficial":         "oficial",
+		"dolar-blue":            "blue",
+		"dolar-bolsa":           "bolsa",
+		"dolar-mep":             "bolsa",
+		"dolar-ccl":             "contadoconliqui",
+		"dolar-contadoconliqui": "contadoconliqui",
+		"dolar-tarjeta":         "tarjeta",
+		"dolar-mayorista":       "mayorista",
+		"dolar-cripto":          "cripto",
+	}
+
+	key := strings.ToLower(symbol)
+	endpoint, ok := m[key]
+	if !ok {
+		// fallback: try to use the part after "dolar-" directly
+		if strings.HasPrefix(key, "dolar-") {
+			endpoint = strings.TrimPrefix(key, "dolar-")
+		} else {
+			return nil, fmt.Errorf("unknown dolar symbol: %s", symbol)
+		}
+	}
+
+	resp, err := p.get(ctx, "/dolares/"+endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("HTTP %d fetching %s from DolarApi", resp.StatusCode, endpoint)
+	}
+
+	var data dolarAPIQuote
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("error parsing DolarApi JSON: %v", err)
+	}
+
+	// Parse venta (prefer) or compra
+	var price float64
+	if data.Venta.Valid {
+		price = data.Venta.Value
+	}
+	if price == 0 && data.Compra.Valid {
+		price = data.Compra.Value
+	}
+	if price == 0 {
+		return nil, fmt.Errorf("DolarApi response for %s has neither venta nor compra", endpoint)
+	}
+
+	q := &Quote{Symbol: symbol, Price: price, Currency: "ARS", Bid: data.Compra.Value, Ask: data.Venta.Value}
+	if t, err := time.Parse(time.RFC3339, data.FechaActualizacion); err == nil {
+		q.Time = t
+	}
+
+	// compute change against last stored price (rueda anterior)
+	if prev := getPrevPrice(symbol); prev > 0 {
+		q.setReference(prev)
+	}
+
+	// store current price for next run
+	if err := setPrevPrice(symbol, price); err != nil {
+		// non-fatal: log to stderr via fmt (don't fail the fetch)
+		fmt.Fprintf(os.Stderr, "warning: could not save dolar cache: %v\n", err)
+	}
+
+	return q, nil
+}
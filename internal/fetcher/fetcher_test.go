@@ -0,0 +1,855 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Provider tests replay hand-written responses from testdata/synthetic, so
+// they run offline. The fixtures follow the shape of the real payloads with
+// round numbers the tests assert on; they are never overwritten by
+// recording (see TestRecord).
+func replayClient() *http.Client {
+	return &http.Client{Transport: &ReplayTransport{Dir: "testdata/synthetic"}}
+}
+
+func TestMain(m *testing.M) {
+	// keep the quote and dolar caches out of the real user cache dir
+	dir, err := os.MkdirTemp("", "waybar-stocks-test")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("XDG_CACHE_HOME", dir)
+	// make routing through the registry hit fixtures as well
+	Register(NewDolarAPI("", replayClient()))
+	Register(NewCoinGecko("", replayClient()))
+	Register(NewYahoo("", replayClient()))
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func approx(t *testing.T, name string, got, want float64) {
+	t.Helper()
+	if math.Abs(got-want) > 1e-6 {
+		t.Errorf("%s = %v, want %v", name, got, want)
+	}
+}
+
+func TestParseTimeframe(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"", 24 * time.Hour},
+		{"15m", 15 * time.Minute},
+		{"15min", 15 * time.Minute},
+		{"1H", time.Hour},
+		{"H", time.Hour},
+		{"D", 24 * time.Hour},
+		{"3D", 72 * time.Hour},
+		{"1W", 7 * 24 * time.Hour},
+		{"1M", 30 * 24 * time.Hour},
+		{"1Y", 365 * 24 * time.Hour},
+		{"2", 48 * time.Hour},
+	}
+	for _, tt := range tests {
+		got, err := ParseTimeframe(tt.in)
+		if err != nil {
+			t.Errorf("ParseTimeframe(%q) error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseTimeframe(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+	for _, bad := range []string{"1Q", "abc", "xD"} {
+		if _, err := ParseTimeframe(bad); err == nil {
+			t.Errorf("ParseTimeframe(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestYahooDaily(t *testing.T) {
+	q, err := NewYahoo("", replayClient()).Fetch(context.Background(), "AAPL", "1D")
+	if err != nil {
+		t.Fatal(err)
+	}
+	approx(t, "Price", q.Price, 230.5)
+	approx(t, "Change", q.Change, 3.5/227*100)
+	approx(t, "AbsChange", q.AbsChange, 3.5)
+	approx(t, "Reference", q.Reference, 227)
+	approx(t, "Open", q.Open, 228)
+	approx(t, "High", q.High, 232.1)
+	approx(t, "Low", q.Low, 228.9)
+	approx(t, "Volume", q.Volume, 51234567)
+	approx(t, "Week52High", q.Week52High, 260.1)
+	if q.Currency != "USD" || q.Exchange != "NasdaqGS" {
+		t.Errorf("Currency, Exchange = %q, %q", q.Currency, q.Exchange)
+	}
+	if !q.Time.Equal(time.Unix(1760126400, 0)) {
+		t.Errorf("Time = %v", q.Time)
+	}
+}
+
+func TestYahooTimeframe(t *testing.T) {
+	// 1W: compare the last close against the close at or before "now - 7d"
+	q, err := NewYahoo("", replayClient()).Fetch(context.Background(), "AAPL", "1W")
+	if err != nil {
+		t.Fatal(err)
+	}
+	approx(t, "Price", q.Price, 230.5)
+	approx(t, "Reference", q.Reference, 220)
+	approx(t, "Change", q.Change, 10.5/220*100)
+}
+
+func TestYahooMinutesTimeframe(t *testing.T) {
+	// "15m" must be read as minutes (range=1d&interval=5m), not months
+	q, err := NewYahoo("", replayClient()).Fetch(context.Background(), "SPY", "15m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	approx(t, "Reference", q.Reference, 502)
+	approx(t, "Change", q.Change, 3.0/502*100)
+}
+
+func TestYahooMalformed(t *testing.T) {
+	p := NewYahoo("", replayClient())
+	if _, err := p.Fetch(context.Background(), "BROKEN", ""); err == nil || !strings.Contains(err.Error(), "regularMarketPrice") {
+		t.Errorf("BROKEN: err = %v, want missing regularMarketPrice", err)
+	}
+	if _, err := p.Fetch(context.Background(), "NOPE", ""); err == nil || !strings.Contains(err.Error(), "delisted") {
+		t.Errorf("NOPE: err = %v, want chart.error description", err)
+	}
+}
+
+func TestCoinGeckoDaily(t *testing.T) {
+	q, err := NewCoinGecko("", replayClient()).Fetch(context.Background(), "BTC-USD", "24H")
+	if err != nil {
+		t.Fatal(err)
+	}
+	approx(t, "Price", q.Price, 107000)
+	approx(t, "Change", q.Change, 1.2495)
+	approx(t, "AbsChange", q.AbsChange, 1320.5)
+	approx(t, "High", q.High, 108200)
+	if q.Currency != "USD" {
+		t.Errorf("Currency = %q", q.Currency)
+	}
+}
+
+func TestCoinGeckoTimeframe(t *testing.T) {
+	q, err := NewCoinGecko("", replayClient()).Fetch(context.Background(), "BTC-USD", "1W")
+	if err != nil {
+		t.Fatal(err)
+	}
+	approx(t, "Price", q.Price, 107000)
+	approx(t, "Reference", q.Reference, 100000)
+	approx(t, "Change", q.Change, 7)
+}
+
+func TestCoinGeckoMissingPrice(t *testing.T) {
+	_, err := NewCoinGecko("", replayClient()).Fetch(context.Background(), "SOL-USD", "")
+	if err == nil || !strings.Contains(err.Error(), "current_price") {
+		t.Errorf("err = %v, want missing current_price", err)
+	}
+}
+
+func TestCoinGeckoResolve(t *testing.T) {
+	p := NewCoinGecko("", replayClient()).(*coinGeckoProvider)
+	ctx := context.Background()
+	tests := []struct {
+		symbol, id, vs string
+	}{
+		{"bitcoin", "bitcoin", "usd"},
+		{"Shiba Inu", "shiba-inu", "usd"},
+		{"BTC-EUR", "bitcoin", "eur"},
+		{"shiba-inu-ars", "shiba-inu", "ars"},
+		// two coins use the ticker: the larger market cap wins
+		{"PEPE-USD", "pepe", "usd"},
+	}
+	for _, tt := range tests {
+		id, vs, err := p.resolve(ctx, tt.symbol)
+		if err != nil || id != tt.id || vs != tt.vs {
+			t.Errorf("resolve(%q) = %q, %q, %v; want %q, %q", tt.symbol, id, vs, err, tt.id, tt.vs)
+		}
+	}
+	if _, _, err := p.resolve(ctx, "NOPE-USD"); err == nil {
+		t.Error("resolve(NOPE-USD): want error")
+	}
+	// a batch reports why a symbol could not be resolved
+	batch, err := p.FetchBatch(ctx, []string{"bitcoin", "NOPE-USD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := batch["bitcoin"]; r.Err != nil || r.Quote == nil {
+		t.Errorf("FetchBatch bitcoin = %v, %v", r.Quote, r.Err)
+	}
+	if err := batch["NOPE-USD"].Err; err == nil || !strings.Contains(err.Error(), "coingecko_id") {
+		t.Errorf("FetchBatch NOPE-USD: err = %v, want the coingecko_id hint", err)
+	}
+
+	pinned := p.WithIDs(map[string]string{"pepe-eur": "based-pepe"}).(*coinGeckoProvider)
+	if id, vs, err := pinned.resolve(ctx, "PEPE-EUR"); err != nil || id != "based-pepe" || vs != "eur" {
+		t.Errorf("pinned resolve = %q, %q, %v; want based-pepe, eur", id, vs, err)
+	}
+	if id, vs, err := pinned.resolve(ctx, "pepe-eur"); err != nil || id != "based-pepe" || vs != "eur" {
+		t.Errorf("pinned resolve of a lowercase symbol = %q, %q, %v", id, vs, err)
+	}
+
+	// routing needs no coin list
+	ct := &countingTransport{next: replayClient().Transport}
+	offline := NewCoinGecko("", &http.Client{Transport: ct})
+	for symbol, want := range map[string]bool{
+		"bitcoin": true, "BTC-EUR": true, "ETH-ARS": true, "btc-usd": true, "SOL-USD": true,
+		"Shiba Inu": true, "shiba-inu-ars": true, "Bitcoin": true,
+		"AAPL": false, "BRK-B": false, "BTC-XYZ": false, "EURUSD=X": false,
+		// lowercase symbols of other providers are left to them
+		"aapl": false, "spy": false, "ggal.ba": false, "btcusdt": false, "dolar-blue": false,
+		"some-unknown-coin": false,
+	} {
+		if got := offline.Supports(symbol); got != want {
+			t.Errorf("Supports(%q) = %v, want %v", symbol, got, want)
+		}
+	}
+	if got := ct.n.Load(); got != 0 {
+		t.Errorf("Supports sent %d requests, want none", got)
+	}
+}
+
+func TestCoinGeckoListBackoff(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	var n atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	// a fresh provider stands for the next one-shot run
+	for range 2 {
+		p := NewCoinGecko(srv.URL, nil).(*coinGeckoProvider)
+		if _, _, err := p.resolve(context.Background(), "PEPE-USD"); err == nil {
+			t.Fatal("resolve without a coin list: want error")
+		}
+	}
+	if got := n.Load(); got != 1 {
+		t.Errorf("list downloads = %d, want 1 until coinGeckoRetry passes", got)
+	}
+}
+
+func TestCoinGeckoVsCurrency(t *testing.T) {
+	q, err := NewCoinGecko("", replayClient()).Fetch(context.Background(), "ETH-ARS", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	approx(t, "Price", q.Price, 5620000)
+	approx(t, "Change", q.Change, 1.5228)
+	if q.Currency != "ARS" {
+		t.Errorf("Currency = %q, want ARS", q.Currency)
+	}
+
+	q, err = NewCoinGecko("", replayClient()).Fetch(context.Background(), "bitcoin", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	approx(t, "Price", q.Price, 107000)
+	if q.Symbol != "bitcoin" || q.Currency != "USD" {
+		t.Errorf("Symbol, Currency = %q, %q", q.Symbol, q.Currency)
+	}
+}
+
+func TestDolarAPI(t *testing.T) {
+	if err := setPrevPrice("dolar-blue", 1200); err != nil {
+		t.Fatal(err)
+	}
+	q, err := NewDolarAPI("", replayClient()).Fetch(context.Background(), "dolar-blue", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	approx(t, "Price", q.Price, 1210)
+	approx(t, "Bid", q.Bid, 1190)
+	approx(t, "Change", q.Change, 10.0/1200*100)
+	if q.Currency != "ARS" {
+		t.Errorf("Currency = %q", q.Currency)
+	}
+
+	// venta is null and compra uses Argentine number formatting
+	q, err = NewDolarAPI("", replayClient()).Fetch(context.Background(), "dolar-cripto", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	approx(t, "Price", q.Price, 1234.5)
+}
+
+// countingTransport counts requests before handing them to the replay transport.
+type countingTransport struct {
+	n    atomic.Int32
+	next http.RoundTripper
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.n.Add(1)
+	return c.next.RoundTrip(req)
+}
+
+func TestFetchAllBatchesCoinGecko(t *testing.T) {
+	ct := &countingTransport{next: replayClient().Transport}
+	Register(NewCoinGecko("", &http.Client{Transport: ct}))
+	defer Register(NewCoinGecko("", replayClient()))
+
+	results := FetchAll(context.Background(), []Request{
+		{Symbol: "BTC-USD"},
+		{Symbol: "ETH-USD", Timeframe: "1D"},
+		{Symbol: "AAPL", Provider: "nope"},
+	}, FetchOptions{})
+
+	if got := ct.n.Load(); got != 1 {
+		t.Errorf("CoinGecko requests = %d, want 1 batched request", got)
+	}
+	if results[0].Err != nil || results[1].Err != nil {
+		t.Fatalf("errors: %v, %v", results[0].Err, results[1].Err)
+	}
+	approx(t, "BTC", results[0].Quote.Price, 107000)
+	approx(t, "ETH", results[1].Quote.Price, 3850.25)
+	if results[2].Err == nil {
+		t.Error("unknown provider: want error")
+	}
+}
+
+// isolateQuotes gives the test an empty quote cache of its own.
+func isolateQuotes(t *testing.T) {
+	old := quotes
+	quotes = &quoteCache{path: filepath.Join(t.TempDir(), "quotes.json")}
+	t.Cleanup(func() { quotes = old })
+}
+
+// stubProvider counts its fetches, each taking delay, and fails while err
+// is set. It never takes part in automatic routing.
+type stubProvider struct {
+	name    string
+	delay   time.Duration
+	err     error
+	n       atomic.Int32
+	started atomic.Int64 // UnixNano of the latest fetch
+}
+
+func (p *stubProvider) Name() string           { return p.name }
+func (p *stubProvider) Supports(s string) bool { return false }
+
+func (p *stubProvider) Fetch(ctx context.Context, symbol, timeframe string) (*Quote, error) {
+	p.n.Add(1)
+	p.started.Store(time.Now().UnixNano())
+	time.Sleep(p.delay)
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &Quote{Symbol: symbol, Price: 1}, nil
+}
+
+// TestFetchAllTicks refreshes on a ticker whose interval is the cache TTL,
+// as the daemon does: every tick must fetch, however long the request takes.
+func TestFetchAllTicks(t *testing.T) {
+	isolateQuotes(t)
+	p := &stubProvider{name: "stub-ticks", delay: 40 * time.Millisecond}
+	Register(p)
+	const ttl = 200 * time.Millisecond
+	reqs := []Request{{Provider: p.name, Symbol: "TICK"}}
+
+	ticker := time.NewTicker(ttl)
+	defer ticker.Stop()
+	for tick := range 5 {
+		if tick > 0 {
+			<-ticker.C
+		}
+		if r := FetchAll(context.Background(), reqs, FetchOptions{TTL: ttl})[0]; r.Err != nil {
+			t.Fatal(r.Err)
+		}
+	}
+	if got := p.n.Load(); got != 5 {
+		t.Errorf("fetches in 5 ticks = %d, want 5", got)
+	}
+}
+
+// TestFetchAllBusyProvider checks that requests queued behind a provider's
+// concurrency limit leave the workers to other providers.
+func TestFetchAllBusyProvider(t *testing.T) {
+	isolateQuotes(t)
+	slow := &stubProvider{name: "stub-slow", delay: 200 * time.Millisecond}
+	fast := &stubProvider{name: "stub-fast"}
+	Register(slow)
+	Register(fast)
+
+	var reqs []Request
+	for i := range 8 {
+		reqs = append(reqs, Request{Provider: slow.name, Symbol: fmt.Sprintf("SLOW%d", i)})
+	}
+	// on one thread the jobs start in a fixed order, and the three slow ones
+	// started before the fast one take every worker unless they wait for
+	// their provider first
+	reqs = slices.Insert(reqs, 3, Request{Provider: fast.name, Symbol: "FAST"})
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+	start := time.Now()
+	FetchAll(context.Background(), reqs, FetchOptions{Workers: 3, PerProvider: 1, Timeout: time.Second})
+	if wait := time.Duration(fast.started.Load() - start.UnixNano()); wait > 150*time.Millisecond {
+		t.Errorf("fast provider waited %v for a worker", wait)
+	}
+}
+
+func TestCacheKeyTimeframeCase(t *testing.T) {
+	isolateQuotes(t)
+	p := &stubProvider{name: "stub-case"}
+	Register(p)
+
+	results := FetchAll(context.Background(), []Request{
+		{Provider: p.name, Symbol: "CASE", Timeframe: "15m"},
+		{Provider: p.name, Symbol: "CASE", Timeframe: "15M"},
+	}, FetchOptions{TTL: time.Minute})
+	for _, r := range results {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+	}
+	if got := p.n.Load(); got != 2 {
+		t.Errorf("fetches = %d, want 2", got)
+	}
+	// the cached quotes are kept apart as well
+	FetchAll(context.Background(), []Request{
+		{Provider: p.name, Symbol: "CASE", Timeframe: "15M"},
+		{Provider: p.name, Symbol: "CASE", Timeframe: "15m"},
+	}, FetchOptions{TTL: time.Minute})
+	if got := p.n.Load(); got != 2 {
+		t.Errorf("fetches after cached run = %d, want 2", got)
+	}
+}
+
+// TestFetchAllFailureBackoff checks that a failed fetch is not retried
+// before fetchRetry, while the last quote stays available as stale.
+func TestFetchAllFailureBackoff(t *testing.T) {
+	isolateQuotes(t)
+	p := &stubProvider{name: "stub-fail"}
+	Register(p)
+	reqs := []Request{{Provider: p.name, Symbol: "FAIL"}}
+	key := cacheKey(p.name, "FAIL", "")
+	quotes.put(map[string]Result{key: {Quote: &Quote{Price: 2}, FetchedAt: time.Now().Add(-2 * time.Hour)}})
+
+	p.err = fmt.Errorf("429 Too Many Requests")
+	for run := range 3 {
+		r := FetchAll(context.Background(), reqs, FetchOptions{TTL: time.Hour})[0]
+		if r.Err == nil || !strings.Contains(r.Err.Error(), "429") {
+			t.Fatalf("run %d: err = %v, want the 429", run, r.Err)
+		}
+	}
+	if got := p.n.Load(); got != 1 {
+		t.Errorf("fetches while backing off = %d, want 1", got)
+	}
+	if q, _, ok := CachedQuote(p.name, "FAIL", ""); !ok || q.Price != 2 {
+		t.Errorf("stale quote = %v, %v, want price 2", q, ok)
+	}
+
+	// once the backoff expires the request is retried, and its success
+	// clears the failure
+	e := quotes.entries[key]
+	e.FailedAt = time.Now().Add(-fetchRetry)
+	quotes.entries[key] = e
+	p.err = nil
+	if r := FetchAll(context.Background(), reqs, FetchOptions{TTL: time.Hour})[0]; r.Err != nil {
+		t.Fatal(r.Err)
+	}
+	if got := p.n.Load(); got != 2 {
+		t.Errorf("fetches after the backoff = %d, want 2", got)
+	}
+	if e := quotes.entries[key]; e.Err != "" {
+		t.Errorf("failure kept after a success: %q", e.Err)
+	}
+}
+
+// finnhubStandIn serves canned /quote and /stock/candle responses and
+// checks the API key header.
+func finnhubStandIn(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Finnhub-Token") != "test-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		q := r.URL.Query()
+		switch {
+		case r.URL.Path == "/quote" && q.Get("symbol") == "AAPL":
+			fmt.Fprint(w, `{"c":230.5,"d":3.5,"dp":1.5419,"h":232.1,"l":228.9,"o":228,"pc":227,"t":1760126400}`)
+		case r.URL.Path == "/quote":
+			fmt.Fprint(w, `{"c":0,"d":null,"dp":null,"h":0,"l":0,"o":0,"pc":0,"t":0}`)
+		case r.URL.Path == "/stock/candle" && q.Get("resolution") == "60":
+			// hourly resolution for 1W; sparse closes, the last one 7 days after the third
+			day := int64(24 * 60 * 60)
+			fmt.Fprintf(w, `{"s":"ok","c":[200,210,220,225,228,230,230.5],"t":[%d,%d,%d,%d,%d,%d,%d]}`,
+				1759000000, 1759000000+day, 1759000000+2*day, 1759000000+5*day, 1759000000+7*day, 1759000000+8*day, 1759000000+9*day)
+		default:
+			fmt.Fprint(w, `{"s":"no_data"}`)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestFinnhub(t *testing.T) {
+	srv := finnhubStandIn(t)
+	p := NewFinnhub(srv.URL, "test-key", nil)
+
+	q, err := p.Fetch(context.Background(), "aapl", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	approx(t, "Price", q.Price, 230.5)
+	approx(t, "Reference", q.Reference, 227)
+	approx(t, "AbsChange", q.AbsChange, 3.5)
+	approx(t, "High", q.High, 232.1)
+	if !q.Time.Equal(time.Unix(1760126400, 0)) {
+		t.Errorf("Time = %v", q.Time)
+	}
+
+	// 1W: the close at or before 7 days before the last candle
+	q, err = p.Fetch(context.Background(), "AAPL", "1W")
+	if err != nil {
+		t.Fatal(err)
+	}
+	approx(t, "1W Reference", q.Reference, 220)
+	approx(t, "1W Change", q.Change, 10.5/220*100)
+
+	if _, err := p.Fetch(context.Background(), "NOPE", ""); err == nil || !strings.Contains(err.Error(), "unknown symbol") {
+		t.Errorf("unknown symbol: err = %v", err)
+	}
+	if _, err := p.Fetch(context.Background(), "AAPL", "15m"); err == nil || !strings.Contains(err.Error(), "no candles") {
+		t.Errorf("no_data candles: err = %v", err)
+	}
+	if _, err := NewFinnhub(srv.URL, "wrong", nil).Fetch(context.Background(), "AAPL", ""); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("bad key: err = %v", err)
+	}
+}
+
+func TestFinnhubRouting(t *testing.T) {
+	keyless := NewFinnhub("", "", nil)
+	if keyless.Supports("AAPL") {
+		t.Error("Finnhub without a key must not take part in routing")
+	}
+	if _, err := keyless.Fetch(context.Background(), "AAPL", ""); err == nil || !strings.Contains(err.Error(), "FINNHUB_API_KEY") {
+		t.Errorf("keyless Fetch: err = %v", err)
+	}
+	keyed := keyless.(KeyedProvider).WithKey("k")
+	if keyed.Supports("AAPL") {
+		t.Error("Finnhub must not take part in routing unless enabled")
+	}
+	routed := keyed.(RoutedProvider).WithRouting(true)
+	for sym, want := range map[string]bool{"AAPL": true, "BRK.B": false, "GGAL.BA": false, "VOD.L": false, "^GSPC": false, "BTC-USD": false, "EURUSD=X": false} {
+		if got := routed.Supports(sym); got != want {
+			t.Errorf("Supports(%q) = %v, want %v", sym, got, want)
+		}
+	}
+}
+
+// alphaVantageStandIn serves canned /query responses and counts them.
+func alphaVantageStandIn(t *testing.T, calls *atomic.Int32) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		q := r.URL.Query()
+		if q.Get("apikey") != "test-key" {
+			fmt.Fprint(w, `{"Error Message": "the parameter apikey is invalid or missing."}`)
+			return
+		}
+		switch q.Get("function") + " " + q.Get("symbol") + q.Get("from_currency") + q.Get("from_symbol") {
+		case "GLOBAL_QUOTE IBM":
+			fmt.Fprint(w, `{"Global Quote": {"01. symbol": "IBM", "02. open": "246.0000", "03. high": "251.0000", "04. low": "244.0000",
+				"05. price": "250.0000", "06. volume": "1000", "07. latest trading day": "2026-10-15",
+				"08. previous close": "245.0000", "09. change": "5.0000", "10. change percent": "2.0408%"}}`)
+		case "GLOBAL_QUOTE LIMIT":
+			fmt.Fprint(w, `{"Information": "Thank you for using Alpha Vantage! Our standard API rate limit is 25 requests per day."}`)
+		case "GLOBAL_QUOTE NOPE":
+			fmt.Fprint(w, `{"Global Quote": {}}`)
+		case "TIME_SERIES_DAILY IBM":
+			fmt.Fprint(w, `{"Meta Data": {}, "Time Series (Daily)": {
+				"2026-10-15": {"4. close": "250.0000"}, "2026-10-14": {"4. close": "248.0000"},
+				"2026-10-08": {"4. close": "240.0000"}, "2026-10-07": {"4. close": "238.0000"},
+				"2026-10-06": {"4. close": "235.0000"}}}`)
+		case "CURRENCY_EXCHANGE_RATE EUR":
+			fmt.Fprint(w, `{"Realtime Currency Exchange Rate": {"1. From_Currency Code": "EUR", "3. To_Currency Code": "USD",
+				"5. Exchange Rate": "1.17000000", "6. Last Refreshed": "2026-10-15 10:00:01",
+				"8. Bid Price": "1.16990000", "9. Ask Price": "1.17010000"}}`)
+		case "FX_DAILY EUR":
+			fmt.Fprint(w, `{"Meta Data": {}, "Time Series FX (Daily)": {
+				"2026-10-15": {"4. close": "1.17000"}, "2026-10-14": {"4. close": "1.16000"},
+				"2026-10-08": {"4. close": "1.15000"}}}`)
+		default:
+			fmt.Fprint(w, `{"Error Message": "Invalid API call."}`)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestAlphaVantage(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	var calls atomic.Int32
+	srv := alphaVantageStandIn(t, &calls)
+	p := NewAlphaVantage(srv.URL, "test-key", nil).(BudgetedProvider).WithBudget(Budget{})
+	ctx := context.Background()
+
+	q, err := p.Fetch(ctx, "ibm", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	approx(t, "Price", q.Price, 250)
+	approx(t, "Reference", q.Reference, 245)
+	approx(t, "Volume", q.Volume, 1000)
+	if q.Time.Format(time.DateOnly) != "2026-10-15" {
+		t.Errorf("Time = %v", q.Time)
+	}
+
+	// 1W: the close at or before 7 days before the last one
+	if q, err = p.Fetch(ctx, "IBM", "1W"); err != nil {
+		t.Fatal(err)
+	}
+	approx(t, "1W Reference", q.Reference, 240)
+	// 1M reaches past the series and falls back to its first close, reusing
+	// the downloaded series
+	if q, err = p.Fetch(ctx, "IBM", "1M"); err != nil {
+		t.Fatal(err)
+	}
+	approx(t, "1M Reference", q.Reference, 235)
+	// the series is persisted for the next one-shot run
+	fresh := NewAlphaVantage(srv.URL, "test-key", nil).(BudgetedProvider).WithBudget(Budget{})
+	if q, err = fresh.Fetch(ctx, "IBM", "1W"); err != nil {
+		t.Fatal(err)
+	}
+	approx(t, "persisted 1W Reference", q.Reference, 240)
+	if n := calls.Load(); n != 5 {
+		t.Errorf("%d requests, want 5 (the daily series is reused)", n)
+	}
+
+	// the daily FX change is relative to the last rate of an earlier day
+	updateAlphaVantageCache(func(c *alphaVantageCache) {
+		c.Rates["EURUSD"] = alphaVantageRate{Day: "2026-10-14", Rate: 1.16}
+	})
+	for _, sym := range []string{"EUR/USD", "eur-usd", "EURUSD=X"} {
+		q, err := p.Fetch(ctx, sym, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		approx(t, sym+" Price", q.Price, 1.17)
+		approx(t, sym+" Reference", q.Reference, 1.16)
+		approx(t, sym+" Bid", q.Bid, 1.1699)
+		if q.Currency != "USD" {
+			t.Errorf("%s Currency = %q", sym, q.Currency)
+		}
+	}
+	if n := calls.Load(); n != 8 {
+		t.Errorf("%d requests, want 8 (one per daily FX quote)", n)
+	}
+	if q, err = p.Fetch(ctx, "EUR/USD", "1W"); err != nil {
+		t.Fatal(err)
+	}
+	approx(t, "FX 1W Reference", q.Reference, 1.15)
+
+	for sym, want := range map[string]string{"LIMIT": "25 requests per day", "NOPE": "unknown symbol"} {
+		if _, err := p.Fetch(ctx, sym, ""); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: err = %v, want %q", sym, err, want)
+		}
+	}
+	if _, err := NewAlphaVantage(srv.URL, "wrong", nil).(BudgetedProvider).WithBudget(Budget{}).Fetch(ctx, "IBM", ""); err == nil || !strings.Contains(err.Error(), "apikey is invalid") {
+		t.Errorf("bad key: err = %v", err)
+	}
+	if _, err := NewAlphaVantage("", "", nil).Fetch(ctx, "IBM", ""); err == nil || !strings.Contains(err.Error(), "ALPHAVANTAGE_API_KEY") {
+		t.Errorf("keyless Fetch: err = %v", err)
+	}
+
+	// the key is part of the URL and must not leak into error messages
+	srv.Close()
+	if _, err := p.Fetch(ctx, "IBM", ""); err == nil || strings.Contains(err.Error(), "test-key") {
+		t.Errorf("connection error: err = %v", err)
+	}
+}
+
+func TestAlphaVantagePacing(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	var calls atomic.Int32
+	srv := alphaVantageStandIn(t, &calls)
+	p := NewAlphaVantage(srv.URL, "test-key", nil)
+	for assets, want := range map[int]time.Duration{1: time.Hour, 5: 6 * time.Hour, 26: 48 * time.Hour} {
+		if got := p.(PacedProvider).MinInterval(assets); got != want {
+			t.Errorf("MinInterval(%d) = %v, want %v", assets, got, want)
+		}
+	}
+
+	Register(p)
+	defer Register(NewAlphaVantage("", "", nil))
+	reqs := []Request{{Provider: "alphavantage", Symbol: "IBM"}}
+	for range 2 {
+		if r := FetchAll(context.Background(), reqs, FetchOptions{TTL: time.Minute}); r[0].Err != nil {
+			t.Fatal(r[0].Err)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("%d requests, want 1 (the quote is cached for MinInterval)", n)
+	}
+}
+
+func TestBudget(t *testing.T) {
+	b := Budget{PerMinute: 2, PerDay: 3}
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	for i, tt := range []struct {
+		at time.Duration
+		ok bool
+	}{
+		{0, true},
+		{time.Second, true},
+		{2 * time.Second, false}, // 2 per minute
+		{61 * time.Second, true},
+		{3 * time.Minute, false}, // 3 per day
+		{24 * time.Hour, true},   // the next UTC day
+	} {
+		err := b.take("budget-test", now.Add(tt.at))
+		if (err == nil) != tt.ok {
+			t.Errorf("request %d at +%v: err = %v, want ok = %v", i, tt.at, err, tt.ok)
+		}
+	}
+}
+
+// binanceStandIn serves canned ticker and kline responses for BTCUSDT and
+// USDTARS, and rejects every other pair like Binance does.
+func binanceStandIn(t *testing.T, klineQuery *atomic.Value) *httptest.Server {
+	tickers := map[string]string{
+		"BTCUSDT": `{"symbol":"BTCUSDT","lastPrice":"110000.00","priceChangePercent":"10.000","openPrice":"100000.00",
+			"highPrice":"111000.00","lowPrice":"99000.00","volume":"1234.5","bidPrice":"109999.99","askPrice":"110000.01","closeTime":1760500000000}`,
+		"USDTARS": `{"symbol":"USDTARS","lastPrice":"1450.0","priceChangePercent":"-1.0","openPrice":"1464.6","closeTime":1760500000000}`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		invalid := func() {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"code":-1121,"msg":"Invalid symbol."}`)
+		}
+		switch r.URL.Path {
+		case "/api/v3/ticker/24hr":
+			if list := q.Get("symbols"); list != "" {
+				var symbols, out []string
+				json.Unmarshal([]byte(list), &symbols)
+				for _, s := range symbols {
+					if tickers[s] == "" {
+						invalid()
+						return
+					}
+					out = append(out, tickers[s])
+				}
+				fmt.Fprint(w, "["+strings.Join(out, ",")+"]")
+			} else if tk := tickers[q.Get("symbol")]; tk != "" {
+				fmt.Fprint(w, tk)
+			} else {
+				invalid()
+			}
+		case "/api/v3/klines":
+			if tickers[q.Get("symbol")] == "" {
+				invalid()
+				return
+			}
+			klineQuery.Store(q)
+			fmt.Fprint(w, `[[1759900000000,"95000.00","96000.00","94000.00","95500.00","10.5",1759903599999,"0",1,"0","0","0"]]`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestBinance(t *testing.T) {
+	var klineQuery atomic.Value
+	p := NewBinance(binanceStandIn(t, &klineQuery).URL, nil)
+	ctx := context.Background()
+
+	q, err := p.Fetch(ctx, "btcusdt", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	approx(t, "Price", q.Price, 110000)
+	approx(t, "Reference", q.Reference, 100000)
+	approx(t, "Change", q.Change, 10)
+	approx(t, "Bid", q.Bid, 109999.99)
+	if q.Currency != "USDT" || q.Symbol != "BTCUSDT" {
+		t.Errorf("Currency, Symbol = %q, %q", q.Currency, q.Symbol)
+	}
+
+	// 1W: the open of the hourly kline starting a week ago
+	if q, err = p.Fetch(ctx, "BTCUSDT", "1W"); err != nil {
+		t.Fatal(err)
+	}
+	approx(t, "1W Reference", q.Reference, 95000)
+	kq := klineQuery.Load().(url.Values)
+	if kq.Get("interval") != "1h" || kq.Get("limit") != "1" {
+		t.Errorf("klines query = %v", kq)
+	}
+	start, _ := strconv.ParseInt(kq.Get("startTime"), 10, 64)
+	if d := time.Since(time.UnixMilli(start)) - 7*24*time.Hour; d < 0 || d > time.Minute {
+		t.Errorf("klines startTime is %v off a week ago", d)
+	}
+
+	// 15m must not be read as 15 months
+	if _, err = p.Fetch(ctx, "BTCUSDT", "15m"); err != nil {
+		t.Fatal(err)
+	}
+	if kq := klineQuery.Load().(url.Values); kq.Get("interval") != "1m" {
+		t.Errorf("15m interval = %q, want 1m", kq.Get("interval"))
+	}
+
+	if q, err = p.Fetch(ctx, "USDT/ARS", ""); err != nil {
+		t.Fatal(err)
+	}
+	approx(t, "USDT/ARS Price", q.Price, 1450)
+	if q.Currency != "ARS" {
+		t.Errorf("USDT/ARS Currency = %q", q.Currency)
+	}
+
+	if _, err := p.Fetch(ctx, "NOPEUSDT", ""); err == nil || !strings.Contains(err.Error(), "Invalid symbol") {
+		t.Errorf("unknown pair: err = %v", err)
+	}
+
+	// one unknown pair fails the batch request; the others still resolve
+	quotes, err := p.(BatchProvider).FetchBatch(ctx, []string{"BTCUSDT", "USDT/ARS", "NOPEUSDT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(quotes) != 3 || quotes["BTCUSDT"].Quote == nil || quotes["USDT/ARS"].Quote == nil {
+		t.Errorf("FetchBatch = %v", quotes)
+	}
+	if err := quotes["NOPEUSDT"].Err; err == nil || !strings.Contains(err.Error(), "Invalid symbol") {
+		t.Errorf("FetchBatch NOPEUSDT: err = %v", err)
+	}
+}
+
+func TestBinanceRouting(t *testing.T) {
+	p := NewBinance("", nil)
+	for sym, want := range map[string]bool{
+		"BTCUSDT": true, "ETHBTC": true, "SOLARS": true, "USDT/ARS": true, "btc/usdt": true,
+		"AAPL": false, "BRK.B": false, "BTC-USD": false, "EURUSD=X": false, "^GSPC": false, "dolar-blue": false,
+	} {
+		if got := p.Supports(sym); got != want {
+			t.Errorf("Supports(%q) = %v, want %v", sym, got, want)
+		}
+	}
+	for sym, want := range map[string]string{"USDT/ARS": "USDTARS", "btc-usdt": "BTCUSDT", "ETHBTC": "ETHBTC"} {
+		if got := binanceSymbol(sym); got != want {
+			t.Errorf("binanceSymbol(%q) = %q, want %q", sym, got, want)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// finnhubQuote is the /quote payload. Finnhub answers unknown symbols with
+// all zeros rather than an error.
+type finnhubQuote struct {
+	Current       *float64 `json:"c"`
+	Change        *float64 `json:"d"`
+	ChangePercent *float64 `json:"dp"`
+	High          *float64 `json:"h"`
+	Low           *float64 `json:"l"`
+	Open          *float64 `json:"o"`
+	PreviousClose *float64 `json:"pc"`
+	Time          *int64   `json:"t"`
+}
+
+// finnhubCandles is the /stock/candle payload.
+type finnhubCandles struct {
+	Close     []float64 `json:"c"`
+	Timestamp []int64   `json:"t"`
+	Status    string    `json:"s"` // "ok" or "no_data"
+}
+
+// finnhubSymbol matches plain US tickers ("AAPL"), leaving exchange
+// suffixes ("GGAL.BA", "VOD.L"), which the free tier does not serve, indices
+// ("^GSPC"), pairs ("BTC-USD") and Yahoo FX symbols to others.
+var finnhubSymbol = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]{0,9}$`)
+
+// finnhubProvider fetches stock quotes from https://finnhub.io. It needs an
+// API key, and only takes part in automatic routing once it has one and
+// routing is enabled (see RoutedProvider).
+type finnhubProvider struct {
+	httpEndpoint
+	apiKey string
+	route  bool
+}
+
+// NewFinnhub returns the Finnhub provider using apiKey. Empty baseURL and
+// nil client select the public API and a default client.
+func NewFinnhub(baseURL, apiKey string, client *http.Client) Provider {
+	return &finnhubProvider{httpEndpoint: newHTTPEndpoint(baseURL, "https://finnhub.io/api/v1", client, 10*time.Second), apiKey: apiKey}
+}
+
+func (p *finnhubProvider) Name() string { return "finnhub" }
+
+// KeyEnv is read when no API key is configured.
+func (p *finnhubProvider) KeyEnv() string { return "FINNHUB_API_KEY" }
+
+// WithKey returns the provider using key.
+func (p *finnhubProvider) WithKey(key string) Provider {
+	c := *p
+	c.apiKey = key
+	return &c
+}
+
+// WithRouting returns the provider taking part in automatic routing when
+// route is set.
+func (p *finnhubProvider) WithRouting(route bool) Provider {
+	c := *p
+	c.route = route
+	return &c
+}
+
+// Supports matches plain US tickers, once routing is enabled and an API key
+// is configured. A key alone is not enough: it may be set for other tools,
+// and the candles of non-daily timeframes need a paid plan.
+func (p *finnhubProvider) Supports(symbol string) bool {
+	return p.route && p.apiKey != "" && finnhubSymbol.MatchString(symbol)
+}
+
+// Fetch uses /quote for the daily change and /stock/candle for other
+// timeframes.
+func (p *finnhubProvider) Fetch(ctx context.Context, symbol, timeframe string) (*Quote, error) {
+	if p.apiKey == "" {
+		return nil, fmt.Errorf("finnhub: no API key (set providers.finnhub.api_key, api_key_file or $%s)", p.KeyEnv())
+	}
+	symbol = strings.ToUpper(symbol)
+	var data finnhubQuote
+	if err := p.call(ctx, "/quote?symbol="+url.QueryEscape(symbol), &data); err != nil {
+		return nil, fmt.Errorf("finnhub %s: %v", symbol, err)
+	}
+	if data.Current == nil || *data.Current == 0 {
+		return nil, fmt.Errorf("finnhub: no quote for %s (unknown symbol?)", symbol)
+	}
+	q := &Quote{Symbol: symbol, Price: *data.Current}
+	for _, f := range []struct {
+		dst *float64
+		src *float64
+	}{{&q.Open, data.Open}, {&q.High, data.High}, {&q.Low, data.Low}} {
+		if f.src != nil {
+			*f.dst = *f.src
+		}
+	}
+	if data.Time != nil && *data.Time > 0 {
+		q.Time = time.Unix(*data.Time, 0)
+	}
+
+	tf := strings.TrimSpace(strings.ToUpper(timeframe))
+	if tf == "" || tf == "D" || tf == "1D" {
+		switch {
+		case data.PreviousClose != nil && *data.PreviousClose != 0:
+			q.setReference(*data.PreviousClose)
+		case data.ChangePercent != nil:
+			q.setChangePercent(*data.ChangePercent)
+		}
+		return q, nil
+	}
+
+	// parse the original string: upper-casing turns minutes ("15m") into months ("15M")
+	dur, err := ParseTimeframe(timeframe)
+	if err != nil {
+		return q, nil
+	}
+	now := time.Now()
+	path := fmt.Sprintf("/stock/candle?symbol=%s&resolution=%s&from=%d&to=%d",
+		url.QueryEscape(symbol), finnhubResolution(dur), now.Add(-dur-4*24*time.Hour).Unix(), now.Unix())
+	var candles finnhubCandles
+	if err := p.call(ctx, path, &candles); err != nil {
+		return nil, fmt.Errorf("finnhub %s candles: %v", symbol, err)
+	}
+	if candles.Status != "ok" || len(candles.Close) == 0 || len(candles.Close) != len(candles.Timestamp) {
+		return nil, fmt.Errorf("finnhub: no candles for %s over %s", symbol, timeframe)
+	}
+	// reference: the last close at or before "last candle - timeframe",
+	// or the first one when the range does not reach that far back
+	last := len(candles.Close) - 1
+	target := candles.Timestamp[last] - int64(dur.Seconds())
+	ref := candles.Close[0]
+	for i := last; i >= 0; i-- {
+		if candles.Timestamp[i] <= target {
+			ref = candles.Close[i]
+			break
+		}
+	}
+	q.setReference(ref)
+	return q, nil
+}
+
+// call GETs path and decodes the JSON response into v.
+func (p *finnhubProvider) call(ctx context.Context, path string, v any) error {
+	header := http.Header{}
+	header.Set("X-Finnhub-Token", p.apiKey)
+	resp, err := p.get(ctx, path, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("HTTP %d: API key rejected or endpoint not in your plan", resp.StatusCode)
+	case http.StatusTooManyRequests:
+		return fmt.Errorf("HTTP 429: rate limit exceeded")
+	default:
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("error parsing JSON: %v", err)
+	}
+	return nil
+}
+
+// finnhubResolution picks a candle resolution giving enough points to
+// cover dur without hitting the response size limit.
+func finnhubResolution(dur time.Duration) string {
+	switch {
+	case dur <= 24*time.Hour:
+		return "5"
+	case dur <= 7*24*time.Hour:
+		return "60"
+	case dur <= 366*24*time.Hour:
+		return "D"
+	}
+	return "W"
+}
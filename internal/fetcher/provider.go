@@ -0,0 +1,164 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Provider is a quote backend (Yahoo, CoinGecko, DolarApi, ...).
+type Provider interface {
+	// Name is the identifier used by the per-asset `provider:` config key.
+	Name() string
+	// Supports reports whether the provider should handle symbol when no
+	// provider is configured explicitly.
+	Supports(symbol string) bool
+	// Fetch returns the current quote for symbol, with the percent change
+	// computed over timeframe (empty means the provider's daily default).
+	Fetch(ctx context.Context, symbol, timeframe string) (*Quote, error)
+}
+
+// KeyedProvider is implemented by providers that need an API key.
+type KeyedProvider interface {
+	Provider
+	// KeyEnv names the environment variable read when no key is configured.
+	KeyEnv() string
+	// WithKey returns a copy of the provider that uses key.
+	WithKey(key string) Provider
+}
+
+// RoutedProvider is implemented by providers that only take part in
+// automatic routing when the config enables it.
+type RoutedProvider interface {
+	Provider
+	// WithRouting returns a copy of the provider that takes part in
+	// automatic routing when route is set.
+	WithRouting(route bool) Provider
+}
+
+// IDProvider is implemented by providers that let assets pin the
+// provider's own id for a symbol (CoinGecko's coin ids).
+type IDProvider interface {
+	Provider
+	// WithIDs returns a copy of the provider that resolves the symbols in ids
+	// to the given ids.
+	WithIDs(ids map[string]string) Provider
+}
+
+// BudgetedProvider is implemented by providers that limit the requests they
+// send (see Budget).
+type BudgetedProvider interface {
+	Provider
+	// DefaultBudget is the budget used unless one is configured.
+	DefaultBudget() Budget
+	// WithBudget returns a copy of the provider limited by b.
+	WithBudget(b Budget) Provider
+}
+
+// httpEndpoint is the base URL and HTTP client a provider talks to. Both
+// are injectable so tests can point providers at fixtures or a local server.
+type httpEndpoint struct {
+	baseURL string
+	client  *http.Client
+}
+
+func newHTTPEndpoint(baseURL, defaultURL string, client *http.Client, timeout time.Duration) httpEndpoint {
+	if baseURL == "" {
+		baseURL = defaultURL
+	}
+	if client == nil {
+		client = &http.Client{Timeout: timeout}
+	}
+	return httpEndpoint{baseURL: strings.TrimRight(baseURL, "/"), client: client}
+}
+
+// get performs a GET request for path (relative to the base URL).
+func (e httpEndpoint) get(ctx context.Context, path string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", e.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	return e.client.Do(req)
+}
+
+var (
+	registryMutex sync.RWMutex
+	registry      []Provider
+)
+
+func init() {
+	// Order matters: the first provider whose Supports matches wins, so the
+	// catch-all Yahoo provider must stay last. Keyed providers only match
+	// once a key is configured (see KeyedProvider), and Finnhub only when
+	// routing is enabled (see RoutedProvider).
+	Register(NewDolarAPI("", nil))
+	Register(NewCoinGecko("", nil))
+	Register(NewBinance("", nil))
+	Register(NewFinnhub("", "", nil))
+	Register(NewAlphaVantage("", "", nil))
+	Register(NewYahoo("", nil))
+}
+
+// Register adds p to the routing table. Providers are tried in registration
+// order; registering a provider with an existing name replaces it in place.
+func Register(p Provider) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	for i, existing := range registry {
+		if existing.Name() == p.Name() {
+			registry[i] = p
+			return
+		}
+	}
+	registry = append(registry, p)
+}
+
+// Lookup returns the registered provider with the given name.
+func Lookup(name string) (Provider, bool) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, p := range registry {
+		if p.Name() == name {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// Providers returns the names of all registered providers in routing order.
+func Providers() []string {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	names := make([]string, len(registry))
+	for i, p := range registry {
+		names[i] = p.Name()
+	}
+	return names
+}
+
+// Resolve picks the provider for symbol. A non-empty name overrides
+// automatic routing.
+func Resolve(name, symbol string) (Provider, error) {
+	if strings.TrimSpace(name) != "" {
+		p, ok := Lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown provider: %s", name)
+		}
+		return p, nil
+	}
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	for _, p := range registry {
+		if p.Supports(symbol) {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("no provider supports %s", symbol)
+}
@@ -0,0 +1,87 @@
+package fetcher
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReplayRedactsSecrets(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"ok":true}`)
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+
+	get := func(rt http.RoundTripper, key string) (string, error) {
+		resp, err := (&http.Client{Transport: rt}).Get(srv.URL + "/query?function=GLOBAL_QUOTE&symbol=IBM&apikey=" + key)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		return string(b), err
+	}
+	if _, err := get(&ReplayTransport{Dir: dir, Record: true}, "SECRET"); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("recorded %d fixtures, want 1", len(files))
+	}
+	b, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "SECRET") || strings.Contains(files[0], "SECRET") {
+		t.Errorf("fixture leaks the API key:\n%s", b)
+	}
+
+	// the fixture is found whatever key the replaying client uses
+	if body, err := get(&ReplayTransport{Dir: dir}, "other"); err != nil || body != `{"ok":true}` {
+		t.Errorf("replay = %q, %v", body, err)
+	}
+}
+
+// TestRecord fetches a quote from every keyless provider (and the keyed
+// ones whose key is in the environment) and saves the responses to
+// testdata/recorded, to compare the real payloads with testdata/synthetic.
+// It only checks that the quotes parse, and needs network access:
+//
+//	WAYBAR_STOCKS_RECORD=1 go test -run TestRecord ./internal/fetcher/
+func TestRecord(t *testing.T) {
+	if os.Getenv("WAYBAR_STOCKS_RECORD") == "" {
+		t.Skip("set WAYBAR_STOCKS_RECORD=1 to record from the real APIs")
+	}
+	isolateQuotes(t)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	client := &http.Client{Transport: &ReplayTransport{Dir: "testdata/recorded", Record: true}}
+	providers := map[Provider]string{
+		NewYahoo("", client):     "AAPL",
+		NewCoinGecko("", client): "bitcoin",
+		NewDolarAPI("", client):  "dolar-blue",
+		NewBinance("", client):   "BTCUSDT",
+	}
+	if key := os.Getenv("FINNHUB_API_KEY"); key != "" {
+		providers[NewFinnhub("", key, client)] = "AAPL"
+	}
+	if key := os.Getenv("ALPHAVANTAGE_API_KEY"); key != "" {
+		providers[NewAlphaVantage("", key, client)] = "IBM"
+	}
+	for p, symbol := range providers {
+		for _, tf := range []string{"", "1W"} {
+			q, err := p.Fetch(context.Background(), symbol, tf)
+			if err != nil {
+				t.Errorf("%s %s %q: %v", p.Name(), symbol, tf, err)
+			} else if q.Price <= 0 {
+				t.Errorf("%s %s %q: price %v", p.Name(), symbol, tf, q.Price)
+			}
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bautitobal/waybar-stocks/internal/websocket"
+)
+
+// Feed is a WebSocket ticker feed that streams the quotes of a provider's
+// symbols between REST refreshes.
+type Feed interface {
+	// Name identifies the feed in StreamEvents and logs.
+	Name() string
+	// Key returns the feed's name for symbol, or false when the feed does
+	// not carry it.
+	Key(symbol string) (string, bool)
+	// URL returns the address to connect to for keys.
+	URL(keys []string) string
+	// Subscribe returns the message sent once connected, or nil.
+	Subscribe(keys []string) []byte
+	// Parse decodes a message, reporting false for anything but a tick.
+	// Ticks carry the price and the rolling 24h change.
+	Parse(msg []byte) (key string, q Quote, ok bool)
+	// Error returns the error reported by msg, such as a rejected
+	// subscription, or nil.
+	Error(msg []byte) error
+}
+
+var (
+	feedsMutex sync.RWMutex
+	// feeds maps provider names to the feed streaming their quotes
+	feeds = map[string]Feed{
+		"binance":   NewBinanceFeed(""),
+		"coingecko": NewCoinbaseFeed(""),
+	}
+)
+
+// FeedFor returns the feed streaming quotes of the named provider.
+func FeedFor(provider string) (Feed, bool) {
+	feedsMutex.RLock()
+	defer feedsMutex.RUnlock()
+	f, ok := feeds[provider]
+	return f, ok
+}
+
+// RegisterFeed makes f stream the quotes of the named provider.
+func RegisterFeed(provider string, f Feed) {
+	feedsMutex.Lock()
+	defer feedsMutex.Unlock()
+	feeds[provider] = f
+}
+
+// binanceFeed is the combined `<symbol>@ticker` stream of Binance.
+type binanceFeed struct{ baseURL string }
+
+// NewBinanceFeed returns the Binance ticker feed. An empty baseURL selects
+// the public stream.
+func NewBinanceFeed(baseURL string) Feed {
+	if baseURL == "" {
+		baseURL = "wss://stream.binance.com:9443"
+	}
+	return &binanceFeed{strings.TrimRight(baseURL, "/")}
+}
+
+func (f *binanceFeed) Name() string { return "binance" }
+
+func (f *binanceFeed) Key(symbol string) (string, bool) {
+	return binanceSymbol(symbol), true
+}
+
+func (f *binanceFeed) URL(keys []string) string {
+	streams := make([]string, len(keys))
+	for i, k := range keys {
+		streams[i] = strings.ToLower(k) + "@ticker"
+	}
+	return f.baseURL + "/stream?streams=" + strings.Join(streams, "/")
+}
+
+// Subscribe is nil: the streams are part of the URL.
+func (f *binanceFeed) Subscribe(keys []string) []byte { return nil }
+
+func (f *binanceFeed) Parse(msg []byte) (string, Quote, bool) {
+	var m struct {
+		Data struct {
+			Event     string     `json:"e"`
+			EventTime int64      `json:"E"` // ms
+			Symbol    string     `json:"s"`
+			Last      flexNumber `json:"c"`
+			Open      flexNumber `json:"o"`
+			High      flexNumber `json:"h"`
+			Low       flexNumber `json:"l"`
+			Volume    flexNumber `json:"v"`
+			Bid       flexNumber `json:"b"`
+			Ask       flexNumber `json:"a"`
+		} `json:"data"`
+	}
+	if json.Unmarshal(msg, &m) != nil || m.Data.Event != "24hrTicker" || !m.Data.Last.Valid {
+		return "", Quote{}, false
+	}
+	d := m.Data
+	q := Quote{Symbol: d.Symbol, Price: d.Last.Value, High: d.High.Value, Low: d.Low.Value,
+		Volume: d.Volume.Value, Bid: d.Bid.Value, Ask: d.Ask.Value, MarketState: "REGULAR"}
+	if d.EventTime > 0 {
+		q.Time = time.UnixMilli(d.EventTime)
+	}
+	q.setReference(d.Open.Value)
+	return d.Symbol, q, true
+}
+
+// Error decodes the replies Binance sends to invalid requests.
+func (f *binanceFeed) Error(msg []byte) error {
+	var m struct {
+		Error *struct {
+			Code int    `json:"code"`
+			Msg  string `json:"msg"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(msg, &m) != nil || m.Error == nil {
+		return nil
+	}
+	return fmt.Errorf("binance: %s (code %d)", m.Error.Msg, m.Error.Code)
+}
+
+// coinbaseProduct matches Coinbase product ids ("BTC-USD", "ETH-EUR").
+// Coinbase only quotes a few currencies; other CoinGecko pairs ("ETH-ARS")
+// stay on REST.
+var coinbaseProduct = regexp.MustCompile(`^[A-Z0-9]{2,10}-(USD|USDC|USDT|EUR|GBP)$`)
+
+// coinbaseFeed is the Coinbase Exchange `ticker` channel, streaming the
+// dashed crypto symbols served by CoinGecko over REST.
+type coinbaseFeed struct{ url string }
+
+// NewCoinbaseFeed returns the Coinbase ticker feed. An empty url selects
+// the public feed.
+func NewCoinbaseFeed(url string) Feed {
+	if url == "" {
+		url = "wss://ws-feed.exchange.coinbase.com"
+	}
+	return &coinbaseFeed{url}
+}
+
+func (f *coinbaseFeed) Name() string { return "coinbase" }
+
+func (f *coinbaseFeed) Key(symbol string) (string, bool) {
+	s := strings.ToUpper(symbol)
+	return s, coinbaseProduct.MatchString(s)
+}
+
+func (f *coinbaseFeed) URL(keys []string) string { return f.url }
+
+func (f *coinbaseFeed) Subscribe(keys []string) []byte {
+	b, _ := json.Marshal(map[string]any{"type": "subscribe", "product_ids": keys, "channels": []string{"ticker"}})
+	return b
+}
+
+func (f *coinbaseFeed) Parse(msg []byte) (string, Quote, bool) {
+	var m struct {
+		Type      string     `json:"type"`
+		ProductID string     `json:"product_id"`
+		Price     flexNumber `json:"price"`
+		Open24h   flexNumber `json:"open_24h"`
+		High24h   flexNumber `json:"high_24h"`
+		Low24h    flexNumber `json:"low_24h"`
+		Volume24h flexNumber `json:"volume_24h"`
+		BestBid   flexNumber `json:"best_bid"`
+		BestAsk   flexNumber `json:"best_ask"`
+		Time      time.Time  `json:"time"`
+	}
+	if json.Unmarshal(msg, &m) != nil || m.Type != "ticker" || !m.Price.Valid {
+		return "", Quote{}, false
+	}
+	q := Quote{Symbol: m.ProductID, Price: m.Price.Value, High: m.High24h.Value, Low: m.Low24h.Value,
+		Volume: m.Volume24h.Value, Bid: m.BestBid.Value, Ask: m.BestAsk.Value, Time: m.Time, MarketState: "REGULAR"}
+	q.setReference(m.Open24h.Value)
+	return m.ProductID, q, true
+}
+
+// Error decodes Coinbase error messages, e.g. a subscription naming a
+// product Coinbase does not list.
+func (f *coinbaseFeed) Error(msg []byte) error {
+	var m struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+		Reason  string `json:"reason"`
+	}
+	if json.Unmarshal(msg, &m) != nil || m.Type != "error" {
+		return nil
+	}
+	if m.Reason != "" {
+		return fmt.Errorf("coinbase: %s: %s", m.Message, m.Reason)
+	}
+	return fmt.Errorf("coinbase: %s", m.Message)
+}
+
+// StreamEvent is a tick, when Quote is set, or a change of the connection
+// state.
+type StreamEvent struct {
+	Feed  string
+	Key   string
+	Quote *Quote
+	// Connected is true once ticks flow, and false when the connection is
+	// lost (with the reason in Err) until they flow again
+	Connected bool
+	Err       error
+}
+
+// Stream keeps a feed subscribed to keys.
+type Stream struct {
+	Feed Feed
+	Keys []string
+	// reconnect delays double from MinBackoff (default 1s) up to MaxBackoff
+	// (default 1m), and are reset once ticks flow again
+	MinBackoff, MaxBackoff time.Duration
+	// IdleTimeout (default 90s) drops connections that stay silent
+	IdleTimeout time.Duration
+}
+
+// Run streams until ctx is cancelled, sending every tick and connection
+// change to events and reconnecting with exponential backoff.
+func (s *Stream) Run(ctx context.Context, events chan<- StreamEvent) {
+	minBackoff, maxBackoff := s.MinBackoff, s.MaxBackoff
+	if minBackoff <= 0 {
+		minBackoff = time.Second
+	}
+	if maxBackoff < minBackoff {
+		maxBackoff = max(time.Minute, minBackoff)
+	}
+	backoff := minBackoff
+	for {
+		flowed, err := s.session(ctx, events)
+		if ctx.Err() != nil {
+			return
+		}
+		if flowed {
+			backoff = minBackoff
+		}
+		if !s.send(ctx, events, StreamEvent{Feed: s.Feed.Name(), Err: err}) {
+			return
+		}
+		// jitter keeps many clients from reconnecting in lockstep
+		wait := backoff/2 + rand.N(backoff/2+1)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// session runs one connection until it fails, reporting whether any tick
+// arrived.
+func (s *Stream) session(ctx context.Context, events chan<- StreamEvent) (flowed bool, err error) {
+	dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	c, err := websocket.Dial(dialCtx, s.Feed.URL(s.Keys), nil)
+	cancel()
+	if err != nil {
+		return false, err
+	}
+	defer c.Close()
+	stop := context.AfterFunc(ctx, func() { c.Close() })
+	defer stop()
+
+	if msg := s.Feed.Subscribe(s.Keys); msg != nil {
+		if err := c.WriteText(msg); err != nil {
+			return false, err
+		}
+	}
+	idle := s.IdleTimeout
+	if idle <= 0 {
+		idle = 90 * time.Second
+	}
+	name := s.Feed.Name()
+	for {
+		c.SetReadDeadline(time.Now().Add(idle))
+		msg, err := c.ReadMessage()
+		if err != nil {
+			return flowed, err
+		}
+		// an error reply means no ticks are coming: report it instead of
+		// waiting for the idle timeout
+		if err := s.Feed.Error(msg); err != nil {
+			return flowed, err
+		}
+		key, q, ok := s.Feed.Parse(msg)
+		if !ok {
+			continue
+		}
+		if !flowed {
+			flowed = true
+			if !s.send(ctx, events, StreamEvent{Feed: name, Connected: true}) {
+				return flowed, ctx.Err()
+			}
+		}
+		if !s.send(ctx, events, StreamEvent{Feed: name, Key: key, Quote: &q, Connected: true}) {
+			return flowed, ctx.Err()
+		}
+	}
+}
+
+func (s *Stream) send(ctx context.Context, events chan<- StreamEvent, ev StreamEvent) bool {
+	select {
+	case events <- ev:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// ApplyTick merges a streamed tick into q, the last quote of an asset with
+// the given timeframe, and returns the result. Daily timeframes take the
+// tick's 24h change; longer ones keep q's reference, so they need a quote
+// from REST first and nil is returned without one.
+func ApplyTick(q *Quote, tick Quote, timeframe string) *Quote {
+	daily := IsDaily(timeframe)
+	var out Quote
+	switch {
+	case q != nil:
+		out = *q
+	case daily:
+		out.Symbol = tick.Symbol
+	default:
+		return nil
+	}
+	ref := out.Reference
+	if daily {
+		ref = tick.Reference
+		out.High, out.Low, out.Volume = tick.High, tick.Low, tick.Volume
+	}
+	out.Price, out.Time, out.MarketState = tick.Price, tick.Time, tick.MarketState
+	if tick.Bid != 0 || tick.Ask != 0 {
+		out.Bid, out.Ask = tick.Bid, tick.Ask
+	}
+	out.Change, out.AbsChange, out.Reference = 0, 0, 0
+	out.setReference(ref)
+	return &out
+}
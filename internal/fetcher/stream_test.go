@@ -0,0 +1,183 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bautitobal/waybar-stocks/internal/websocket"
+)
+
+// wsStandIn serves fn on every WebSocket connection and returns the
+// server's ws:// URL.
+func wsStandIn(t *testing.T, fn func(c *websocket.Conn, r *http.Request)) string {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		fn(c, r)
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+// nextEvent returns the next event, failing the test after a few seconds.
+func nextEvent(t *testing.T, events <-chan StreamEvent) StreamEvent {
+	t.Helper()
+	select {
+	case ev := <-events:
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("no stream event")
+		return StreamEvent{}
+	}
+}
+
+func TestBinanceStream(t *testing.T) {
+	var conns atomic.Int32
+	url := wsStandIn(t, func(c *websocket.Conn, r *http.Request) {
+		n := conns.Add(1)
+		if got := r.URL.Query().Get("streams"); got != "btcusdt@ticker/usdtars@ticker" {
+			t.Errorf("streams = %q", got)
+		}
+		// every connection sends two ticks and drops, forcing a reconnect
+		for i := range 2 {
+			price := 100000 + 1000*int(n) + i
+			fmt.Fprintf(wsWriter{c}, `{"stream":"btcusdt@ticker","data":{"e":"24hrTicker","E":1760500000000,"s":"BTCUSDT","c":"%d.00","o":"100000.00","h":"110000","l":"99000","v":"12.5","b":"1","a":"2"}}`, price)
+		}
+	})
+	s := &Stream{Feed: NewBinanceFeed(url), Keys: []string{"BTCUSDT", "USDTARS"}, MinBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan StreamEvent)
+	go s.Run(ctx, events)
+
+	for conn := 1; conn <= 2; conn++ {
+		if ev := nextEvent(t, events); !ev.Connected || ev.Quote != nil {
+			t.Fatalf("connection %d: first event = %+v, want connected", conn, ev)
+		}
+		for i := range 2 {
+			ev := nextEvent(t, events)
+			if ev.Quote == nil || ev.Key != "BTCUSDT" {
+				t.Fatalf("connection %d: event = %+v, want a BTCUSDT tick", conn, ev)
+			}
+			approx(t, "Price", ev.Quote.Price, float64(100000+1000*conn+i))
+			approx(t, "Reference", ev.Quote.Reference, 100000)
+		}
+		if ev := nextEvent(t, events); ev.Connected || ev.Err == nil {
+			t.Fatalf("connection %d: event = %+v, want a disconnect", conn, ev)
+		}
+	}
+}
+
+// wsWriter writes text messages to a WebSocket connection.
+type wsWriter struct{ c *websocket.Conn }
+
+func (w wsWriter) Write(p []byte) (int, error) { return len(p), w.c.WriteText(p) }
+
+func TestCoinbaseStream(t *testing.T) {
+	url := wsStandIn(t, func(c *websocket.Conn, r *http.Request) {
+		msg, err := c.ReadMessage()
+		if err != nil {
+			return
+		}
+		var sub struct {
+			Type       string   `json:"type"`
+			ProductIDs []string `json:"product_ids"`
+			Channels   []string `json:"channels"`
+		}
+		json.Unmarshal(msg, &sub)
+		if sub.Type != "subscribe" || strings.Join(sub.ProductIDs, ",") != "BTC-USD" || strings.Join(sub.Channels, ",") != "ticker" {
+			t.Errorf("subscribe message = %s", msg)
+		}
+		c.WriteText([]byte(`{"type":"subscriptions","channels":[{"name":"ticker","product_ids":["BTC-USD"]}]}`))
+		c.WriteText([]byte(`{"type":"ticker","product_id":"BTC-USD","price":"110000.00","open_24h":"100000.00","best_bid":"109999","best_ask":"110001","time":"2026-10-15T12:00:00.000000Z"}`))
+		c.ReadMessage() // until the client goes away
+	})
+	f := NewCoinbaseFeed(url)
+	if _, ok := f.Key("bitcoin"); ok {
+		t.Error("Coinbase feed accepted a non-product symbol")
+	}
+	if _, ok := f.Key("ETH-ARS"); ok {
+		t.Error("Coinbase feed accepted a currency it does not quote")
+	}
+	key, _ := f.Key("btc-usd")
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan StreamEvent)
+	done := make(chan struct{})
+	go func() {
+		(&Stream{Feed: f, Keys: []string{key}}).Run(ctx, events)
+		close(done)
+	}()
+
+	nextEvent(t, events) // connected
+	ev := nextEvent(t, events)
+	if ev.Quote == nil || ev.Key != "BTC-USD" {
+		t.Fatalf("event = %+v, want a BTC-USD tick", ev)
+	}
+	approx(t, "Change", ev.Quote.Change, 10)
+	approx(t, "Ask", ev.Quote.Ask, 110001)
+	if ev.Quote.Time.IsZero() {
+		t.Error("tick has no time")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+}
+
+// TestCoinbaseStreamError checks that a rejected subscription is reported
+// at once rather than after the idle timeout.
+func TestCoinbaseStreamError(t *testing.T) {
+	url := wsStandIn(t, func(c *websocket.Conn, r *http.Request) {
+		if _, err := c.ReadMessage(); err != nil {
+			return
+		}
+		c.WriteText([]byte(`{"type":"error","message":"Failed to subscribe","reason":"NOPE-USD is not a valid product"}`))
+		c.ReadMessage() // Coinbase keeps the connection open
+	})
+	s := &Stream{Feed: NewCoinbaseFeed(url), Keys: []string{"NOPE-USD"}, IdleTimeout: time.Minute}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan StreamEvent)
+	go s.Run(ctx, events)
+
+	ev := nextEvent(t, events)
+	if ev.Connected || ev.Err == nil || !strings.Contains(ev.Err.Error(), "NOPE-USD is not a valid product") {
+		t.Fatalf("event = %+v, want the subscription error", ev)
+	}
+}
+
+func TestApplyTick(t *testing.T) {
+	tick := Quote{Symbol: "BTCUSDT", Price: 110, Reference: 100, High: 111, MarketState: "REGULAR"}
+	tick.setReference(100)
+
+	// daily: the tick's 24h change, keeping fields only REST provides
+	q := ApplyTick(&Quote{Symbol: "BTC/USDT", Price: 105, Reference: 99, Currency: "USDT"}, tick, "")
+	approx(t, "daily Change", q.Change, 10)
+	if q.Symbol != "BTC/USDT" || q.Currency != "USDT" || q.High != 111 {
+		t.Errorf("daily quote = %+v", q)
+	}
+
+	// longer timeframes keep the REST reference
+	q = ApplyTick(&Quote{Price: 105, Reference: 88}, tick, "1W")
+	approx(t, "1W Reference", q.Reference, 88)
+	approx(t, "1W Change", q.Change, 25)
+	if ApplyTick(nil, tick, "1W") != nil {
+		t.Error("ApplyTick without a REST quote for 1W: want nil")
+	}
+	if q := ApplyTick(nil, tick, "24h"); q == nil || q.Price != 110 {
+		t.Errorf("ApplyTick without a REST quote for 24h = %+v", q)
+	}
+}
@@ -0,0 +1,306 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// yahooChartResponse is the v8/finance/chart payload. Nullable values are
+// pointers so a missing field is distinguishable from zero.
+type yahooChartResponse struct {
+	Chart struct {
+		Result []yahooChartResult `json:"result"`
+		Error  *struct {
+			Code        string `json:"code"`
+			Description string `json:"description"`
+		} `json:"error"`
+	} `json:"chart"`
+}
+
+type yahooChartResult struct {
+	Meta       yahooMeta `json:"meta"`
+	Timestamp  []*int64  `json:"timestamp"`
+	Indicators struct {
+		Quote []yahooIndicatorQuote `json:"quote"`
+	} `json:"indicators"`
+}
+
+type yahooMeta struct {
+	Currency                   string                   `json:"currency"`
+	Symbol                     string                   `json:"symbol"`
+	ExchangeName               string                   `json:"exchangeName"`
+	FullExchangeName           string                   `json:"fullExchangeName"`
+	RegularMarketPrice         *float64                 `json:"regularMarketPrice"`
+	RegularMarketChangePercent *float64                 `json:"regularMarketChangePercent"`
+	RegularMarketTime          *int64                   `json:"regularMarketTime"`
+	RegularMarketDayHigh       *float64                 `json:"regularMarketDayHigh"`
+	RegularMarketDayLow        *float64                 `json:"regularMarketDayLow"`
+	RegularMarketVolume        *float64                 `json:"regularMarketVolume"`
+	FiftyTwoWeekHigh           *float64                 `json:"fiftyTwoWeekHigh"`
+	FiftyTwoWeekLow            *float64                 `json:"fiftyTwoWeekLow"`
+	PreviousClose              *float64                 `json:"previousClose"`
+	ChartPreviousClose         *float64                 `json:"chartPreviousClose"`
+	CurrentTradingPeriod       *yahooCurrentTradingDays `json:"currentTradingPeriod"`
+}
+
+type yahooCurrentTradingDays struct {
+	Pre     *yahooTradingPeriod `json:"pre"`
+	Regular *yahooTradingPeriod `json:"regular"`
+	Post    *yahooTradingPeriod `json:"post"`
+}
+
+type yahooTradingPeriod struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+type yahooIndicatorQuote struct {
+	Open   []*float64 `json:"open"`
+	High   []*float64 `json:"high"`
+	Low    []*float64 `json:"low"`
+	Close  []*float64 `json:"close"`
+	Volume []*float64 `json:"volume"`
+}
+
+// closes returns indicators.quote[0].close, or nil when absent.
+func (r *yahooChartResult) closes() []*float64 {
+	if len(r.Indicators.Quote) == 0 {
+		return nil
+	}
+	return r.Indicators.Quote[0].Close
+}
+
+// yahooProvider fetches stocks, ETFs and indices from the Yahoo Finance chart API.
+type yahooProvider struct {
+	httpEndpoint
+}
+
+// NewYahoo returns the Yahoo Finance provider. Empty baseURL and nil client
+// select the public API and a default client.
+func NewYahoo(baseURL string, client *http.Client) Provider {
+	return &yahooProvider{newHTTPEndpoint(baseURL, "https://query1.finance.yahoo.com", client, 10*time.Second)}
+}
+
+func (p *yahooProvider) Name() string { return "yahoo" }
+
+// Supports always matches: Yahoo is the catch-all for anything not claimed
+// by a more specific provider.
+func (p *yahooProvider) Supports(symbol string) bool { return true }
+
+// Fetch fetches quote and computes change for the requested timeframe.
+func (p *yahooProvider) Fetch(ctx context.Context, symbol, timeframe string) (*Quote, error) {
+	// default URL (we may add range/interval query params later)
+	baseURL := fmt.Sprintf("/v8/finance/chart/%s", url.PathEscape(symbol))
+	res, err := p.chart(ctx, baseURL, symbol)
+	if err != nil {
+		return nil, err
+	}
+	meta := &res.Meta
+
+	// Try to get price from meta, fallback to indicators.quote.close last value
+	var price float64
+	if meta.RegularMarketPrice != nil {
+		price = *meta.RegularMarketPrice
+	}
+	if price == 0 {
+		if _, v, ok := lastValid(res.closes(), -1); ok {
+			price = v
+		}
+	}
+	if price == 0 {
+		return nil, fmt.Errorf("could not determine price for %s: missing meta.regularMarketPrice and indicators.quote[0].close", symbol)
+	}
+	q := yahooQuote(symbol, price, res)
+
+	// If timeframe is empty or daily, prefer meta change percent or previousClose
+	tf := strings.TrimSpace(strings.ToUpper(timeframe))
+	if tf == "" || tf == "D" || tf == "1D" {
+		switch {
+		case meta.RegularMarketChangePercent != nil:
+			q.setChangePercent(*meta.RegularMarketChangePercent)
+		case meta.PreviousClose != nil && *meta.PreviousClose != 0:
+			q.setReference(*meta.PreviousClose)
+		case meta.ChartPreviousClose != nil && *meta.ChartPreviousClose != 0:
+			q.setReference(*meta.ChartPreviousClose)
+		}
+		// fallback: compute from last two closes
+		if q.Change == 0 {
+			closes := res.closes()
+			if i, last, ok := lastValid(closes, -1); ok {
+				if _, prevVal, ok := lastValid(closes, i); ok && prevVal != 0 {
+					q.setChangePercent((last - prevVal) / prevVal * 100)
+				}
+			}
+		}
+		return q, nil
+	}
+
+	// For other timeframes, request chart with a range/interval likely to include the timeframe
+	// parse the original string: upper-casing turns minutes ("15m") into months ("15M")
+	dur, err := ParseTimeframe(timeframe)
+	if err != nil {
+		// unknown timeframe: fallback to daily
+		return q, nil
+	}
+
+	yarange, interval := mapDurationToYahooRangeInterval(dur)
+	r2, err := p.chart(ctx, fmt.Sprintf("%s?range=%s&interval=%s", baseURL, yarange, interval), symbol)
+	if err != nil {
+		return nil, err
+	}
+	timestamps, closes := r2.Timestamp, r2.closes()
+	if len(timestamps) == 0 || len(closes) == 0 {
+		return q, nil
+	}
+	if len(closes) > len(timestamps) {
+		closes = closes[:len(timestamps)]
+	}
+	// find last non-nil close (with a timestamp) as current
+	var lastIdx int = -1
+	var currClose float64
+	for i := len(closes) - 1; i >= 0; i-- {
+		if closes[i] != nil && timestamps[i] != nil {
+			lastIdx, currClose = i, *closes[i]
+			break
+		}
+	}
+	if lastIdx == -1 {
+		return q, nil
+	}
+	lastTs := *timestamps[lastIdx]
+
+	// target timestamp
+	targetTs := lastTs - int64(dur.Seconds())
+	// find index with timestamp <= targetTs
+	var targetIdx int = -1
+	for i := lastIdx; i >= 0; i-- {
+		if timestamps[i] == nil || closes[i] == nil {
+			continue
+		}
+		if *timestamps[i] <= targetTs {
+			targetIdx = i
+			break
+		}
+	}
+	var prevClose float64
+	if targetIdx == -1 {
+		// not found earlier; use first value
+		for _, c := range closes {
+			if c != nil {
+				prevClose = *c
+				break
+			}
+		}
+	} else {
+		prevClose = *closes[targetIdx]
+	}
+	q.Price = currClose
+	q.setReference(prevClose)
+	return q, nil
+}
+
+// yahooQuote builds a Quote (without change) from the chart metadata.
+func yahooQuote(symbol string, price float64, res *yahooChartResult) *Quote {
+	meta := &res.Meta
+	q := &Quote{
+		Symbol:      symbol,
+		Price:       price,
+		Currency:    meta.Currency,
+		Exchange:    meta.FullExchangeName,
+		MarketState: yahooMarketState(meta, time.Now()),
+	}
+	if q.Exchange == "" {
+		q.Exchange = meta.ExchangeName
+	}
+	if meta.RegularMarketTime != nil {
+		q.Time = time.Unix(*meta.RegularMarketTime, 0)
+	}
+	if len(res.Indicators.Quote) > 0 {
+		for _, v := range res.Indicators.Quote[0].Open {
+			if v != nil {
+				q.Open = *v
+				break
+			}
+		}
+	}
+	for _, f := range []struct {
+		dst *float64
+		src *float64
+	}{
+		{&q.High, meta.RegularMarketDayHigh},
+		{&q.Low, meta.RegularMarketDayLow},
+		{&q.Volume, meta.RegularMarketVolume},
+		{&q.Week52High, meta.FiftyTwoWeekHigh},
+		{&q.Week52Low, meta.FiftyTwoWeekLow},
+	} {
+		if f.src != nil {
+			*f.dst = *f.src
+		}
+	}
+	return q
+}
+
+// chart performs a v8/finance/chart request and returns its first result.
+func (p *yahooProvider) chart(ctx context.Context, path, symbol string) (*yahooChartResult, error) {
+	header := http.Header{}
+	header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36")
+	resp, err := p.get(ctx, path, header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("HTTP %d while fetching %s", resp.StatusCode, symbol)
+	}
+
+	var data yahooChartResponse
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("error parsing Yahoo JSON for %s: %v", symbol, err)
+	}
+	if e := data.Chart.Error; e != nil {
+		return nil, fmt.Errorf("yahoo error for %s: %s (%s)", symbol, e.Description, e.Code)
+	}
+	if len(data.Chart.Result) == 0 {
+		return nil, fmt.Errorf("no results for %s: missing chart.result", symbol)
+	}
+	return &data.Chart.Result[0], nil
+}
+
+// lastValid returns the index and value of the last non-nil entry of vals
+// before index before (-1 means search the whole slice).
+func lastValid(vals []*float64, before int) (int, float64, bool) {
+	if before < 0 || before > len(vals) {
+		before = len(vals)
+	}
+	for i := before - 1; i >= 0; i-- {
+		if vals[i] != nil {
+			return i, *vals[i], true
+		}
+	}
+	return -1, 0, false
+}
+
+// yahooMarketState derives the market state from meta.currentTradingPeriod:
+// "PRE", "REGULAR", "POST" or "CLOSED". Returns "" when the period is missing.
+func yahooMarketState(meta *yahooMeta, now time.Time) string {
+	periods := meta.CurrentTradingPeriod
+	if periods == nil {
+		return ""
+	}
+	ts := now.Unix()
+	for _, p := range []struct {
+		name   string
+		period *yahooTradingPeriod
+	}{{"PRE", periods.Pre}, {"REGULAR", periods.Regular}, {"POST", periods.Post}} {
+		if p.period != nil && p.period.Start <= ts && ts < p.period.End {
+			return p.name
+		}
+	}
+	return MarketClosed
+}
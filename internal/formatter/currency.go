@@ -0,0 +1,49 @@
+package formatter
+
+import "strings"
+
+// currencySymbols maps ISO 4217 codes to their symbols. Currencies missing
+// here, or whose symbol is ambiguous (ARS, MXN, CAD... all use "$"), are
+// rendered by code.
+var currencySymbols = map[string]string{
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+	"JPY": "¥",
+	"CNY": "¥",
+	"INR": "₹",
+	"KRW": "₩",
+	"BRL": "R$",
+	"TRY": "₺",
+	"ILS": "₪",
+	"UAH": "₴",
+	"VND": "₫",
+	"NGN": "₦",
+	"PHP": "₱",
+	"BTC": "₿",
+	"GBp": "p", // Yahoo quotes London listings in pence
+}
+
+// CurrencySymbol returns the symbol of the quote currency, or its code when
+// there is no unambiguous symbol.
+func (d Data) CurrencySymbol() string {
+	if s, ok := currencySymbols[d.Quote.Currency]; ok {
+		return s
+	}
+	return d.Currency
+}
+
+// withSymbol attaches the currency to the formatted amount s: "$1.20",
+// "-€3.40", "12.5p" or "ARS 1.245,50".
+func withSymbol(s, currency string) string {
+	sym, ok := currencySymbols[currency]
+	switch {
+	case !ok:
+		return currency + " " + s
+	case currency == "GBp":
+		return s + sym
+	case strings.HasPrefix(s, "-"):
+		return "-" + sym + s[1:]
+	}
+	return sym + s
+}
@@ -2,39 +2,151 @@ package formatter
 
 import (
 	"fmt"
+	"math"
 	"strings"
+
+	"github.com/bautitobal/waybar-stocks/internal/fetcher"
 )
 
-func escapeMarkup(s string) string {
+// EscapeMarkup escapes the characters that are special in Pango markup.
+func EscapeMarkup(s string) string {
 	s = strings.ReplaceAll(s, "&", "&amp;")
 	s = strings.ReplaceAll(s, "<", "&lt;")
 	s = strings.ReplaceAll(s, ">", "&gt;")
 	return s
 }
 
-func FormatText(format, symbol, timeframe string, price, change float64, colorUp, colorDown, colorNeutral string) string {
-	icon := "▲"
-	color := colorUp
+// Colors are the span colors used for rising, falling and unchanged quotes.
+// UpStrong and DownStrong color moves beyond Thresholds.Strong and default
+// to Up and Down.
+type Colors struct {
+	Up         string
+	Down       string
+	Neutral    string
+	UpStrong   string
+	DownStrong string
+}
 
-	if change < 0 {
-		icon = "▼"
-		color = colorDown
-	} else if change == 0 {
-		color = colorNeutral
+// Arrows are the direction markers rendered by {icon} and .Arrow.
+type Arrows struct {
+	Up   string
+	Down string
+}
+
+// DefaultArrows are used when Style.Arrows is unset.
+var DefaultArrows = Arrows{Up: "▲", Down: "▼"}
+
+// Style controls how a quote is rendered.
+type Style struct {
+	Colors     Colors
+	Number     Number
+	Arrows     Arrows
+	Icon       string // asset icon, e.g. a Nerd Font glyph or a flag
+	Thresholds Thresholds
+}
+
+// Data is what a format is rendered from. Templates see every Quote field
+// ({{.Price}}, {{.AbsChange}}, {{.High}}, {{.Currency}}, ...) plus Name and
+// Timeframe, and the Icon and Arrow of the Style. String fields are
+// markup-escaped; the raw quote stays available as .Quote.
+type Data struct {
+	*fetcher.Quote
+	Name      string
+	Timeframe string
+	// escaped copies of the Quote's string fields, which they shadow
+	Symbol      string
+	Currency    string
+	Exchange    string
+	MarketState string
+
+	style Style // set by Render
+}
+
+// NewData builds the render data for a quote of the asset called name.
+func NewData(name, timeframe string, q *fetcher.Quote) Data {
+	return Data{
+		Quote:       q,
+		Name:        EscapeMarkup(name),
+		Timeframe:   EscapeMarkup(timeframe),
+		Symbol:      EscapeMarkup(q.Symbol),
+		Currency:    EscapeMarkup(q.Currency),
+		Exchange:    EscapeMarkup(q.Exchange),
+		MarketState: EscapeMarkup(q.MarketState),
 	}
+}
+
+// FormattedPrice is Price with the configured precision and separators.
+func (d Data) FormattedPrice() string {
+	return EscapeMarkup(d.style.Number.Price(d.Price))
+}
+
+// FormattedChange is Change with the configured precision and separators.
+func (d Data) FormattedChange() string {
+	return EscapeMarkup(d.style.Number.Change(d.Change))
+}
+
+// Icon is the asset icon from the Style, markup-escaped.
+func (d Data) Icon() string {
+	return EscapeMarkup(d.style.Icon)
+}
+
+// Arrow is the up or down arrow from the Style for the sign of Change.
+func (d Data) Arrow() string {
+	return d.style.arrow(d.Change)
+}
 
-	// if the format does not include {timeframe}, append the timeframe to the symbol
-	sym := escapeMarkup(symbol)
-	tfEsc := escapeMarkup(timeframe)
-	if tfEsc != "" && !strings.Contains(format, "{timeframe}") {
-		sym = sym + " (" + tfEsc + ")"
+// arrow returns the Style's up or down arrow for the sign of change,
+// markup-escaped.
+func (s Style) arrow(change float64) string {
+	a := s.Arrows
+	if a.Up == "" {
+		a.Up = DefaultArrows.Up
+	}
+	if a.Down == "" {
+		a.Down = DefaultArrows.Down
+	}
+	if change < 0 {
+		return EscapeMarkup(a.Down)
 	}
+	return EscapeMarkup(a.Up)
+}
 
-	out := strings.ReplaceAll(format, "{symbol}", sym)
-	out = strings.ReplaceAll(out, "{price}", fmt.Sprintf("%.2f", price))
-	out = strings.ReplaceAll(out, "{change}", fmt.Sprintf("%.2f", change))
-	out = strings.ReplaceAll(out, "{timeframe}", tfEsc)
-	out = strings.ReplaceAll(out, "{icon}", icon)
+// IsOpen reports whether the market is in its regular session (or the
+// provider does not report a market state, e.g. for FX).
+func (d Data) IsOpen() bool {
+	return d.Quote.MarketState == "" || d.Quote.MarketState == "REGULAR"
+}
 
-	return fmt.Sprintf("<span color='%s'>%s</span>", color, out)
+// Render formats d with format. Formats containing "{{" are Go text/template
+// templates (see Data and the helpers in template.go); anything else uses the
+// legacy {symbol}/{price}/{change}/{icon}/... tokens, which accept modifiers
+// such as {price:compact:symbol} (see tokens.go). The result is wrapped in a
+// span colored by the direction and size of the change (see Thresholds).
+func Render(format string, d Data, s Style) (string, error) {
+	d.style = s
+	var out string
+	if IsTemplate(format) {
+		var err error
+		if out, err = renderTemplate(format, d, s); err != nil {
+			return "", err
+		}
+	} else {
+		out = renderLegacy(format, d)
+	}
+	return fmt.Sprintf("<span color='%s'>%s</span>", s.Thresholds.Color(d.Change, s.Colors), out), nil
+}
+
+// Percentage maps change linearly from [min, max] into 0–100, clamping
+// values outside the range. Used for Waybar's "percentage" field.
+func Percentage(change, min, max float64) int {
+	if max <= min {
+		return 50
+	}
+	p := (change - min) / (max - min) * 100
+	if p < 0 {
+		p = 0
+	} else if p > 100 {
+		p = 100
+	}
+	return int(math.Round(p))
 }
@@ -0,0 +1,248 @@
+package formatter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bautitobal/waybar-stocks/internal/fetcher"
+)
+
+var testColors = Colors{Up: "#00FF00", Down: "#FF5555", Neutral: "#FFFFFF"}
+
+func TestRenderLegacy(t *testing.T) {
+	q := &fetcher.Quote{Price: 107000, Change: 1.25}
+	got, err := Render("{symbol} {price} ({change}%{icon})", NewData("S&P500", "1W", q), Style{Colors: testColors, Number: DefaultNumber})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "<span color='#00FF00'>S&amp;P500 (1W) 107000.00 (1.25%▲)</span>"
+	if got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	format := `{{.Name}} {{round 1 .Price}}{{if .IsOpen}} vol {{humanize .Volume}}{{end}} {{arrow .Change}}{{.Change | abs | round 2 | pad 6}}`
+	open := &fetcher.Quote{Price: 230.46, Change: -1.5, Volume: 51234567, MarketState: "REGULAR"}
+	closed := &fetcher.Quote{Price: 230.46, Change: -1.5, Volume: 51234567, MarketState: "CLOSED"}
+
+	tests := []struct {
+		q    *fetcher.Quote
+		want string
+	}{
+		{open, "<span color='#FF5555'>AAPL 230.5 vol 51.2M ▼  1.50</span>"},
+		{closed, "<span color='#FF5555'>AAPL 230.5 ▼  1.50</span>"},
+	}
+	for _, tt := range tests {
+		got, err := Render(format, NewData("AAPL", "", tt.q), Style{Colors: testColors, Number: DefaultNumber})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("got  %q\nwant %q", got, tt.want)
+		}
+	}
+}
+
+func TestRenderTemplateEscapes(t *testing.T) {
+	q := &fetcher.Quote{Symbol: "M&M.NS", Exchange: "<NSE>", Currency: "INR", Price: 3000}
+	got, err := Render("{{.Symbol}} {{.Exchange}} {{.Currency}}", NewData("M&M", "", q), Style{Colors: testColors, Number: DefaultNumber})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<span color='#FFFFFF'>M&amp;M.NS &lt;NSE&gt; INR</span>"; got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+	// currency tokens still look up the raw code
+	got, err = Render("{price:symbol} {currency}", NewData("M&M", "", q), Style{Colors: testColors, Number: DefaultNumber})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<span color='#FFFFFF'>₹3000.00 INR</span>"; got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	if err := Check("{symbol} {price}"); err != nil {
+		t.Errorf("legacy format: %v", err)
+	}
+	if err := Check("{{.Name"); err == nil {
+		t.Error("unterminated action: want error")
+	}
+	// execution errors are caught as well
+	for _, bad := range []string{"{{.Nope}}", "{{round .Price}}", "{{pad .Name 3}}", "{{.Quote.Nope}}"} {
+		if err := Check(bad); err == nil {
+			t.Errorf("Check(%q): want error", bad)
+		}
+	}
+	for _, good := range []string{"{{.Name}} {{round 2 .Price}}{{arrow .Change}}", "{{if .Bid}}{{.Bid}}/{{.Ask}}{{end}} {{.FormattedPrice}}", "{{.Time.Format \"15:04\"}}"} {
+		if err := Check(good); err != nil {
+			t.Errorf("Check(%q) = %v", good, err)
+		}
+	}
+	if _, err := Render(`{{color "red'><b" .Name}}`, NewData("X", "", &fetcher.Quote{}), Style{}); err == nil {
+		t.Error("invalid color: want error")
+	}
+}
+
+func TestPercentage(t *testing.T) {
+	for _, tt := range []struct {
+		change float64
+		want   int
+	}{{-10, 0}, {-5, 0}, {0, 50}, {2.5, 75}, {9, 100}} {
+		if got := Percentage(tt.change, -5, 5); got != tt.want {
+			t.Errorf("Percentage(%v) = %d, want %d", tt.change, got, tt.want)
+		}
+	}
+}
+
+func TestNumberFormat(t *testing.T) {
+	esAR, _ := DefaultNumber.Locale("es_AR")
+	enUS, _ := DefaultNumber.Locale("en-US.UTF-8")
+	enUS.Precision = 0
+	shib := DefaultNumber
+	shib.Precision = 8
+
+	tests := []struct {
+		n    Number
+		x    float64
+		want string
+	}{
+		{DefaultNumber, 107000, "107000.00"},
+		{DefaultNumber, -1.254, "-1.25"},
+		{esAR, 1245.5, "1.245,50"},
+		{esAR, -1234567.891, "-1.234.567,89"},
+		{enUS, 107000.4, "107,000"},
+		{enUS, 999, "999"},
+		{shib, 0.00001234, "0.00001234"},
+	}
+	for _, tt := range tests {
+		if got := tt.n.Price(tt.x); got != tt.want {
+			t.Errorf("Price(%v) = %q, want %q", tt.x, got, tt.want)
+		}
+	}
+	if _, ok := DefaultNumber.Locale("xx_XX"); ok {
+		t.Error("unknown locale: want ok = false")
+	}
+}
+
+func TestTokenModifiers(t *testing.T) {
+	esAR, _ := DefaultNumber.Locale("es_AR")
+	tests := []struct {
+		format string
+		q      *fetcher.Quote
+		n      Number
+		want   string
+	}{
+		{"{price:compact} vol {volume:compact}", &fetcher.Quote{Price: 5234.5, Volume: 3.45e9}, DefaultNumber, "5.2K vol 3.5B"},
+		{"{price:symbol}", &fetcher.Quote{Price: 230.5, Currency: "USD"}, DefaultNumber, "$230.50"},
+		{"{abs_change:symbol}", &fetcher.Quote{AbsChange: -3.4, Currency: "EUR"}, DefaultNumber, "-€3.40"},
+		{"{price:compact:symbol}", &fetcher.Quote{Price: 1.2e12, Currency: "USD"}, DefaultNumber, "$1.2T"},
+		{"{price:symbol}", &fetcher.Quote{Price: 1245.5, Currency: "ARS"}, esAR, "ARS 1.245,50"},
+		{"{price:code} {currency:symbol}", &fetcher.Quote{Price: 1245.5, Currency: "ARS"}, esAR, "1.245,50 ARS ARS"},
+		{"{price:symbol}", &fetcher.Quote{Price: 1245.5}, DefaultNumber, "1245.50"},
+		{"{price:symbol}", &fetcher.Quote{Price: 812.4, Currency: "GBp"}, DefaultNumber, "812.40p"},
+		{"{unknown:compact} {volume}", &fetcher.Quote{Volume: 1234567}, DefaultNumber, "{unknown:compact} 1234567"},
+	}
+	for _, tt := range tests {
+		got, err := Render(tt.format, NewData("X", "", tt.q), Style{Number: tt.n})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = strings.TrimSuffix(strings.TrimPrefix(got, "<span color=''>"), "</span>")
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.format, got, tt.want)
+		}
+	}
+	for _, bad := range []string{"{price:bogus}", "{change:symbol}", "{icon:compact}"} {
+		if err := Check(bad); err == nil {
+			t.Errorf("Check(%q): want error", bad)
+		}
+	}
+}
+
+func TestRenderIconAndArrows(t *testing.T) {
+	s := Style{Colors: testColors, Number: DefaultNumber, Arrows: Arrows{Up: "↑", Down: "↓"}, Icon: "₿"}
+	got, err := Render("{asset_icon} {symbol} {change}%{icon}", NewData("BTC", "", &fetcher.Quote{Change: -2}), s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<span color='#FF5555'>₿ BTC -2.00%↓</span>"; got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+	got, err = Render("{{.Icon}}{{.Arrow}}", NewData("BTC", "", &fetcher.Quote{Change: 1}), Style{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<span color=''>▲</span>"; got != want {
+		t.Errorf("default arrows: got %q, want %q", got, want)
+	}
+	// the arrow helper follows the Style too
+	got, err = Render("{{arrow .Change}}", NewData("BTC", "", &fetcher.Quote{Change: -2}), s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<span color='#FF5555'>↓</span>"; got != want {
+		t.Errorf("arrow helper: got %q, want %q", got, want)
+	}
+}
+
+func TestThresholds(t *testing.T) {
+	c := Colors{Up: "#000000", Down: "#FF0000", Neutral: "#FFFFFF", UpStrong: "#00FF00"}
+	th := Thresholds{Neutral: 0.05, Strong: 3}
+	tests := []struct {
+		change  float64
+		classes string
+		color   string
+	}{
+		{0.01, "neutral", "#FFFFFF"},
+		{-0.04, "neutral", "#FFFFFF"},
+		{1, "up up-weak", "#000000"},
+		{5, "up up-strong", "#00FF00"},
+		{-1, "down down-weak", "#FF0000"},
+		{-3, "down down-strong", "#FF0000"}, // DownStrong defaults to Down
+	}
+	for _, tt := range tests {
+		if got := strings.Join(th.Classes(tt.change), " "); got != tt.classes {
+			t.Errorf("Classes(%v) = %q, want %q", tt.change, got, tt.classes)
+		}
+		if got := th.Color(tt.change, c); got != tt.color {
+			t.Errorf("Color(%v) = %q, want %q", tt.change, got, tt.color)
+		}
+	}
+
+	th = Thresholds{Strong: 2, Gradient: true}
+	for _, tt := range []struct {
+		change float64
+		want   string
+	}{{0.5, "#004000"}, {1, "#008000"}, {2, "#00FF00"}, {-1, "#FF0000"}} {
+		if got := th.Color(tt.change, c); got != tt.want {
+			t.Errorf("gradient Color(%v) = %q, want %q", tt.change, got, tt.want)
+		}
+	}
+	if err := CheckGradient(Colors{Up: "green"}); err == nil {
+		t.Error("CheckGradient(green): want error")
+	}
+}
+
+func TestMarquee(t *testing.T) {
+	s := "<span color='#0F0'>A &amp; <b>B</b></span> | "
+	if got := Width(s); got != 8 {
+		t.Errorf("Width = %d, want 8", got)
+	}
+	tests := []struct {
+		offset, width int
+		want          string
+	}{
+		{0, 3, "<span color='#0F0'>A &amp;</span>"},
+		{3, 3, "<span color='#0F0'> </span><span color='#0F0'><b>B</b></span> "},
+		{6, 4, "| <span color='#0F0'>A </span>"},
+		{0, 8, s},
+	}
+	for _, tt := range tests {
+		if got := Marquee(s, tt.offset, tt.width); got != tt.want {
+			t.Errorf("Marquee(%d, %d) = %q, want %q", tt.offset, tt.width, got, tt.want)
+		}
+	}
+}
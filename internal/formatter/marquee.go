@@ -0,0 +1,116 @@
+package formatter
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// glyph is one visible character of a markup string: a rune or an entity
+// such as "&amp;", with the spans that are open around it.
+type glyph struct {
+	text  string
+	stack int // index into markup.stacks
+}
+
+// tag is an open markup element.
+type tag struct {
+	open string // the whole opening tag, e.g. "<span color='#0F0'>"
+	name string // "span"
+}
+
+// markup is a Pango markup string split into visible glyphs.
+type markup struct {
+	glyphs []glyph
+	stacks [][]tag // snapshots of the open tags; stacks[0] is empty
+}
+
+// parseMarkup splits s into glyphs. Tags do not count towards the width.
+func parseMarkup(s string) markup {
+	m := markup{stacks: [][]tag{nil}}
+	cur := 0
+	for len(s) > 0 {
+		switch {
+		case s[0] == '<':
+			end := strings.IndexByte(s, '>')
+			if end < 0 {
+				end = len(s) - 1
+			}
+			t := s[:end+1]
+			s = s[end+1:]
+			stack := m.stacks[cur]
+			switch {
+			case strings.HasPrefix(t, "</"):
+				if len(stack) > 0 {
+					stack = stack[:len(stack)-1]
+				}
+			case strings.HasSuffix(t, "/>"):
+				continue
+			default:
+				name := strings.TrimLeft(t, "<")
+				if i := strings.IndexAny(name, " \t\n>"); i >= 0 {
+					name = name[:i]
+				}
+				stack = append(stack[:len(stack):len(stack)], tag{open: t, name: name})
+			}
+			m.stacks = append(m.stacks, stack)
+			cur = len(m.stacks) - 1
+		case s[0] == '&' && strings.IndexByte(s, ';') > 0:
+			end := strings.IndexByte(s, ';')
+			m.glyphs = append(m.glyphs, glyph{text: s[:end+1], stack: cur})
+			s = s[end+1:]
+		default:
+			_, size := utf8.DecodeRuneInString(s)
+			m.glyphs = append(m.glyphs, glyph{text: s[:size], stack: cur})
+			s = s[size:]
+		}
+	}
+	return m
+}
+
+// Width returns the number of visible characters in the markup string s.
+func Width(s string) int {
+	return len(parseMarkup(s).glyphs)
+}
+
+// Marquee returns a window of width visible characters of the markup string
+// s starting at offset, wrapping around to the start. Spans cut by the
+// window are closed and reopened so the result is valid markup. Strings no
+// wider than width are returned unchanged.
+func Marquee(s string, offset, width int) string {
+	m := parseMarkup(s)
+	n := len(m.glyphs)
+	if n <= width || width <= 0 {
+		return s
+	}
+	offset %= n
+	if offset < 0 {
+		offset += n
+	}
+
+	var b strings.Builder
+	open := -1 // stack of the current run
+	for i := 0; i < width; i++ {
+		g := m.glyphs[(offset+i)%n]
+		if g.stack != open {
+			m.close(&b, open)
+			for _, t := range m.stacks[g.stack] {
+				b.WriteString(t.open)
+			}
+			open = g.stack
+		}
+		b.WriteString(g.text)
+	}
+	m.close(&b, open)
+	return b.String()
+}
+
+// close writes the closing tags of the given stack.
+func (m markup) close(b *strings.Builder, stack int) {
+	if stack < 0 {
+		return
+	}
+	tags := m.stacks[stack]
+	for i := len(tags) - 1; i >= 0; i-- {
+		b.WriteString("</" + tags[i].name + ">")
+	}
+}
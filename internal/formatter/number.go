@@ -0,0 +1,104 @@
+package formatter
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Number controls how prices and changes are printed.
+type Number struct {
+	Precision       int    // decimals for prices
+	ChangePrecision int    // decimals for percent changes
+	Thousands       string // thousands separator, "" for none
+	Decimal         string // decimal separator
+}
+
+// DefaultNumber matches the historical "%.2f" output.
+var DefaultNumber = Number{Precision: 2, ChangePrecision: 2, Decimal: "."}
+
+// locales maps locale names to their separators.
+var locales = map[string]Number{
+	"en_US": {Thousands: ",", Decimal: "."},
+	"en_GB": {Thousands: ",", Decimal: "."},
+	"es_AR": {Thousands: ".", Decimal: ","},
+	"es_ES": {Thousands: ".", Decimal: ","},
+	"pt_BR": {Thousands: ".", Decimal: ","},
+	"de_DE": {Thousands: ".", Decimal: ","},
+	"it_IT": {Thousands: ".", Decimal: ","},
+	"fr_FR": {Thousands: " ", Decimal: ","},
+	"de_CH": {Thousands: "’", Decimal: "."},
+}
+
+// Locales returns the supported locale names, sorted.
+func Locales() []string {
+	names := make([]string, 0, len(locales))
+	for name := range locales {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Locale returns n with the separators of the named locale ("es_AR",
+// "en-US" and "es_AR.UTF-8" are all accepted).
+func (n Number) Locale(name string) (Number, bool) {
+	name, _, _ = strings.Cut(name, ".")
+	l, ok := locales[strings.ReplaceAll(name, "-", "_")]
+	if !ok {
+		return n, false
+	}
+	n.Thousands, n.Decimal = l.Thousands, l.Decimal
+	return n, true
+}
+
+// Format prints x with the given decimals and n's separators, e.g.
+// 1245.5 -> "1.245,50" for es_AR.
+func (n Number) Format(x float64, precision int) string {
+	s := strconv.FormatFloat(x, 'f', precision, 64)
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	intPart, frac, _ := strings.Cut(s, ".")
+
+	var b strings.Builder
+	b.WriteString(sign)
+	for i, d := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteString(n.Thousands)
+		}
+		b.WriteRune(d)
+	}
+	if frac != "" {
+		b.WriteString(n.Decimal)
+		b.WriteString(frac)
+	}
+	return b.String()
+}
+
+// Price formats a price with n.Precision decimals.
+func (n Number) Price(x float64) string {
+	return n.Format(x, n.Precision)
+}
+
+// Change formats a change with n.ChangePrecision decimals.
+func (n Number) Change(x float64) string {
+	return n.Format(x, n.ChangePrecision)
+}
+
+// Compact formats x with K/M/B/T suffixes and the given decimals, e.g.
+// 1234 -> "1.2K". Values below 1000 keep their decimals.
+func (n Number) Compact(x float64, decimals int) string {
+	abs := math.Abs(x)
+	for _, u := range []struct {
+		size   float64
+		suffix string
+	}{{1e12, "T"}, {1e9, "B"}, {1e6, "M"}, {1e3, "K"}} {
+		if abs >= u.size {
+			return n.Format(x/u.size, decimals) + u.suffix
+		}
+	}
+	return n.Format(x, decimals)
+}
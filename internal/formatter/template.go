@@ -0,0 +1,134 @@
+package formatter
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bautitobal/waybar-stocks/internal/fetcher"
+)
+
+// templates caches parsed formats; formats come from the config and are
+// rendered on every tick.
+var templates sync.Map // format string -> *template.Template
+
+var funcs = template.FuncMap{
+	// round formats x with the given number of decimals: {{round 2 .Price}}
+	"round": func(decimals int, x float64) string {
+		return fmt.Sprintf("%.*f", decimals, x)
+	},
+	// humanize renders x in compact notation: 1.2K, 3.4M, 1.1B
+	"humanize": func(x float64) string {
+		return DefaultNumber.Compact(x, 1)
+	},
+	// pad pads s with spaces to width characters, right-aligned like %*s
+	// (a negative width left-aligns)
+	"pad": func(width int, s string) string {
+		n := utf8.RuneCountInString(s)
+		switch {
+		case width > n:
+			return strings.Repeat(" ", width-n) + s
+		case -width > n:
+			return s + strings.Repeat(" ", -width-n)
+		}
+		return s
+	},
+	// color wraps s in a span with the given color: {{color "#888888" .Name}}
+	"color": func(c, s string) (string, error) {
+		if !IsColor(c) {
+			return "", fmt.Errorf("invalid color %q", c)
+		}
+		return fmt.Sprintf("<span color='%s'>%s</span>", c, s), nil
+	},
+	// arrow returns the Style's up or down arrow for the sign of change;
+	// bound per render in renderTemplate
+	"arrow":  Style{}.arrow,
+	"abs":    math.Abs,
+	"escape": EscapeMarkup,
+}
+
+// colorPattern accepts #RGB, #RRGGBB, #RRGGBBAA and plain color names
+// ("red", "orange"), which is what Pango understands in color attributes.
+var colorPattern = regexp.MustCompile(`^(#([0-9a-fA-F]{3}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})|[a-zA-Z]+)$`)
+
+// IsColor reports whether c is safe to use as a Pango color attribute.
+func IsColor(c string) bool {
+	return colorPattern.MatchString(c)
+}
+
+// IsTemplate reports whether format uses the text/template syntax.
+func IsTemplate(format string) bool {
+	return strings.Contains(format, "{{")
+}
+
+// Check parses format and reports syntax errors, or unknown modifiers in
+// legacy formats. Templates are also executed once with sampleQuote, which
+// catches unknown fields and wrong function arguments.
+func Check(format string) error {
+	if !IsTemplate(format) {
+		return checkTokens(format)
+	}
+	if _, err := parseTemplate(format); err != nil {
+		return err
+	}
+	d := NewData("Sample", "1D", &sampleQuote)
+	d.style = Style{Number: DefaultNumber}
+	_, err := renderTemplate(format, d, d.style)
+	return err
+}
+
+// sampleQuote has every field set, so Check exercises templates that only
+// print a field when it is present.
+var sampleQuote = fetcher.Quote{
+	Symbol:      "SMPL",
+	Price:       101.5,
+	Change:      1.5,
+	AbsChange:   1.5,
+	Reference:   100,
+	Currency:    "USD",
+	Time:        time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC),
+	Open:        100.5,
+	High:        102,
+	Low:         99.5,
+	Volume:      1e6,
+	Week52High:  120,
+	Week52Low:   80,
+	Bid:         101.4,
+	Ask:         101.6,
+	Exchange:    "NMS",
+	MarketState: "REGULAR",
+}
+
+func parseTemplate(format string) (*template.Template, error) {
+	if t, ok := templates.Load(format); ok {
+		return t.(*template.Template), nil
+	}
+	t, err := template.New("format").Funcs(funcs).Parse(format)
+	if err != nil {
+		return nil, err
+	}
+	templates.Store(format, t)
+	return t, nil
+}
+
+func renderTemplate(format string, d Data, s Style) (string, error) {
+	t, err := parseTemplate(format)
+	if err != nil {
+		return "", err
+	}
+	// the cached template is shared, so bind the Style to a copy
+	if t, err = t.Clone(); err != nil {
+		return "", err
+	}
+	t.Funcs(template.FuncMap{"arrow": s.arrow})
+	var b strings.Builder
+	if err := t.Execute(&b, d); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
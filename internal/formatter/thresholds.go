@@ -0,0 +1,112 @@
+package formatter
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Thresholds split percent changes into neutral, weak and strong moves.
+type Thresholds struct {
+	Neutral  float64 // |change| below this is neutral (0: only exactly 0)
+	Strong   float64 // |change| at or above this is strong (0: never)
+	Gradient bool    // blend Up→UpStrong (Down→DownStrong) instead of stepping
+}
+
+// Level returns the direction ("up", "down" or "neutral") and strength
+// ("weak", "strong" or "") of change.
+func (t Thresholds) Level(change float64) (direction, strength string) {
+	abs := math.Abs(change)
+	if change == 0 || abs < t.Neutral {
+		return "neutral", ""
+	}
+	direction, strength = "up", "weak"
+	if change < 0 {
+		direction = "down"
+	}
+	if t.Strong > 0 && abs >= t.Strong {
+		strength = "strong"
+	}
+	return direction, strength
+}
+
+// Classes returns the Waybar classes for change, e.g. ["up", "up-strong"]
+// or ["neutral"].
+func (t Thresholds) Classes(change float64) []string {
+	direction, strength := t.Level(change)
+	if strength == "" {
+		return []string{direction}
+	}
+	return []string{direction, direction + "-" + strength}
+}
+
+// Color picks the span color for change. With Gradient set, weak moves are
+// interpolated between the weak and strong colors by their magnitude.
+func (t Thresholds) Color(change float64, c Colors) string {
+	direction, strength := t.Level(change)
+	weak, strong := c.Up, c.UpStrong
+	switch direction {
+	case "neutral":
+		return c.Neutral
+	case "down":
+		weak, strong = c.Down, c.DownStrong
+	}
+	if strong == "" {
+		strong = weak
+	}
+	if strength == "strong" {
+		return strong
+	}
+	if !t.Gradient || t.Strong <= t.Neutral {
+		return weak
+	}
+	from, err1 := parseHex(weak)
+	to, err2 := parseHex(strong)
+	if err1 != nil || err2 != nil {
+		return weak
+	}
+	f := (math.Abs(change) - t.Neutral) / (t.Strong - t.Neutral)
+	return blend(from, to, f)
+}
+
+// CheckGradient reports colors that cannot be interpolated.
+func CheckGradient(c Colors) error {
+	for _, color := range []string{c.Up, c.UpStrong, c.Down, c.DownStrong} {
+		if color == "" {
+			continue
+		}
+		if _, err := parseHex(color); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseHex parses #RGB or #RRGGBB.
+func parseHex(c string) ([3]uint8, error) {
+	var rgb [3]uint8
+	if len(c) == 4 && c[0] == '#' {
+		c = "#" + string([]byte{c[1], c[1], c[2], c[2], c[3], c[3]})
+	}
+	if len(c) != 7 || c[0] != '#' {
+		return rgb, fmt.Errorf("gradient needs #RGB or #RRGGBB colors, got %q", c)
+	}
+	for i := range rgb {
+		v, err := strconv.ParseUint(c[1+2*i:3+2*i], 16, 8)
+		if err != nil {
+			return rgb, fmt.Errorf("gradient needs #RGB or #RRGGBB colors, got %q", c)
+		}
+		rgb[i] = uint8(v)
+	}
+	return rgb, nil
+}
+
+// blend interpolates from→to at f in [0, 1].
+func blend(from, to [3]uint8, f float64) string {
+	f = math.Max(0, math.Min(1, f))
+	var out [3]uint8
+	for i := range out {
+		out[i] = uint8(math.Round(float64(from[i]) + (float64(to[i])-float64(from[i]))*f))
+	}
+	return fmt.Sprintf("#%02X%02X%02X", out[0], out[1], out[2])
+}
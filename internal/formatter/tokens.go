@@ -0,0 +1,157 @@
+package formatter
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// tokenPattern matches legacy tokens with optional modifiers, e.g. {price}
+// or {price:compact:symbol}.
+var tokenPattern = regexp.MustCompile(`\{([a-z0-9_]+)((?::[a-z]+)*)\}`)
+
+// tokenKind groups tokens by the modifiers they accept.
+type tokenKind int
+
+const (
+	textToken   tokenKind = iota // no modifiers
+	moneyToken                   // compact, symbol, code
+	numberToken                  // compact
+)
+
+var tokens = map[string]tokenKind{
+	"symbol":      textToken,
+	"timeframe":   textToken,
+	"icon":        textToken,
+	"asset_icon":  textToken,
+	"currency":    textToken, // accepts "symbol" as well
+	"price":       moneyToken,
+	"abs_change":  moneyToken,
+	"open":        moneyToken,
+	"high":        moneyToken,
+	"low":         moneyToken,
+	"bid":         moneyToken,
+	"ask":         moneyToken,
+	"week52_high": moneyToken,
+	"week52_low":  moneyToken,
+	"change":      numberToken,
+	"volume":      numberToken,
+}
+
+// modifiers lists the modifiers accepted by each kind of token.
+var modifiers = map[tokenKind][]string{
+	moneyToken:  {"compact", "symbol", "code"},
+	numberToken: {"compact"},
+}
+
+// checkTokens reports known tokens used with modifiers they do not accept.
+// Unknown tokens are left alone and printed literally.
+func checkTokens(format string) error {
+	for _, m := range tokenPattern.FindAllStringSubmatch(format, -1) {
+		kind, ok := tokens[m[1]]
+		if !ok || m[2] == "" {
+			continue
+		}
+		allowed := modifiers[kind]
+		if m[1] == "currency" {
+			allowed = []string{"symbol"}
+		}
+		for _, mod := range strings.Split(m[2][1:], ":") {
+			if !slices.Contains(allowed, mod) {
+				if len(allowed) == 0 {
+					return fmt.Errorf("token %s does not accept modifiers", m[0])
+				}
+				return fmt.Errorf("unknown modifier %q in %s (allowed: %s)", mod, m[0], strings.Join(allowed, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// renderLegacy replaces the {token} and {token:modifier} placeholders.
+func renderLegacy(format string, d Data) string {
+	// if the format does not include {timeframe}, append the timeframe to the symbol
+	sym := d.Name
+	if d.Timeframe != "" && !strings.Contains(format, "{timeframe") {
+		sym = sym + " (" + d.Timeframe + ")"
+	}
+
+	return tokenPattern.ReplaceAllStringFunc(format, func(tok string) string {
+		m := tokenPattern.FindStringSubmatch(tok)
+		var mods []string
+		if m[2] != "" {
+			mods = strings.Split(m[2][1:], ":")
+		}
+		switch m[1] {
+		case "symbol":
+			return sym
+		case "timeframe":
+			return d.Timeframe
+		case "icon":
+			return d.Arrow()
+		case "asset_icon":
+			return d.Icon()
+		case "currency":
+			if slices.Contains(mods, "symbol") {
+				return d.CurrencySymbol()
+			}
+			return d.Currency
+		case "change":
+			return d.style.Number.render(d.Change, d.style.Number.ChangePrecision, mods, "")
+		case "volume":
+			return d.style.Number.render(d.Volume, 0, mods, "")
+		}
+		x, ok := d.moneyField(m[1])
+		if !ok {
+			return tok
+		}
+		return d.style.Number.render(x, d.style.Number.Precision, mods, d.Quote.Currency)
+	})
+}
+
+// moneyField returns the quote field behind a money token.
+func (d Data) moneyField(name string) (float64, bool) {
+	switch name {
+	case "price":
+		return d.Price, true
+	case "abs_change":
+		return d.AbsChange, true
+	case "open":
+		return d.Open, true
+	case "high":
+		return d.High, true
+	case "low":
+		return d.Low, true
+	case "bid":
+		return d.Bid, true
+	case "ask":
+		return d.Ask, true
+	case "week52_high":
+		return d.Week52High, true
+	case "week52_low":
+		return d.Week52Low, true
+	}
+	return 0, false
+}
+
+// render formats x for a token with the given modifiers: "compact" uses
+// K/M/B/T suffixes, "symbol" prefixes the currency symbol and "code"
+// appends the currency code.
+func (n Number) render(x float64, precision int, mods []string, currency string) string {
+	var s string
+	if slices.Contains(mods, "compact") {
+		s = n.Compact(x, 1)
+	} else {
+		s = n.Format(x, precision)
+	}
+	if currency != "" {
+		switch {
+		case slices.Contains(mods, "symbol"):
+			s = withSymbol(s, currency)
+		case slices.Contains(mods, "code"):
+			s += " " + currency
+		}
+	}
+	return EscapeMarkup(s)
+}
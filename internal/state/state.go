@@ -0,0 +1,173 @@
+// Package state persists the user's rotation controls (--next, --prev,
+// --pause, --pin) so one-shot runs and the daemon agree on what is shown.
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/bautitobal/waybar-stocks/internal/fetcher"
+)
+
+// State is the rotation position chosen by the user, layered over the
+// clock-driven rotation.
+type State struct {
+	// Offset is added to the clock step, moved by Next/Prev
+	Offset int `json:"offset"`
+	// Paused freezes the rotation at PausedStep
+	Paused     bool `json:"paused"`
+	PausedStep int  `json:"paused_step"`
+	// Pinned is the symbol (or name) of the asset shown regardless of the clock
+	Pinned string `json:"pinned,omitempty"`
+}
+
+// Step returns the rotation step to show for the clock step.
+func (s State) Step(clock int) int {
+	if s.Paused {
+		return s.PausedStep
+	}
+	return clock + s.Offset
+}
+
+// Seek makes Step(clock) return step from now on, and unpins.
+func (s *State) Seek(clock, step int) {
+	s.Pinned = ""
+	if s.Paused {
+		s.PausedStep = step
+	} else {
+		s.Offset = step - clock
+	}
+}
+
+// TogglePause freezes the rotation at the current step, or resumes it from
+// that step.
+func (s *State) TogglePause(clock int) {
+	if s.Paused {
+		s.Offset = s.PausedStep - clock
+	} else {
+		s.PausedStep = clock + s.Offset
+	}
+	s.Paused = !s.Paused
+}
+
+// Pin pins symbol, or unpins when it is empty or already pinned.
+func (s *State) Pin(symbol string) {
+	if symbol == "" || strings.EqualFold(symbol, s.Pinned) {
+		s.Pinned = ""
+		return
+	}
+	s.Pinned = symbol
+}
+
+// Path is the state file, in the cache directory.
+func Path() string {
+	return filepath.Join(fetcher.CacheDir(), "state.json")
+}
+
+// Load reads the state file. A missing file is the zero State.
+func Load() (State, error) {
+	var s State
+	b, err := os.ReadFile(Path())
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	return s, json.Unmarshal(b, &s)
+}
+
+// Save writes the state file atomically.
+func Save(s State) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := Path()
+	tmp, err := os.CreateTemp(filepath.Dir(path), "state-*.json")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// Update loads the state, applies fn and saves it.
+func Update(fn func(*State)) (State, error) {
+	s, err := Load()
+	if err != nil {
+		return s, err
+	}
+	fn(&s)
+	return s, Save(s)
+}
+
+// pidPath is where a running daemon records its process id.
+func pidPath() string {
+	return filepath.Join(fetcher.CacheDir(), "daemon.pid")
+}
+
+// WritePID records the current process as the running daemon. The returned
+// func removes the record.
+func WritePID() (func(), error) {
+	path := pidPath()
+	if err := os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644); err != nil {
+		return func() {}, err
+	}
+	return func() { os.Remove(path) }, nil
+}
+
+// DaemonPID returns the process id of the running daemon, if any. A pid
+// file left behind by a daemon that was killed may name an unrelated
+// process by now, so the process must also run this program.
+func DaemonPID() (int, bool) {
+	b, err := os.ReadFile(pidPath())
+	if err != nil {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil || pid <= 0 || pid == os.Getpid() {
+		return 0, false
+	}
+	// signal 0 only checks that the process exists
+	if err := syscall.Kill(pid, 0); err != nil {
+		return 0, false
+	}
+	if !sameExecutable(pid) {
+		return 0, false
+	}
+	return pid, true
+}
+
+// sameExecutable reports whether process pid runs the same program as the
+// current process, going by /proc. Without /proc it reports false.
+func sameExecutable(pid int) bool {
+	self, err := os.Executable()
+	if err != nil {
+		return false
+	}
+	exe, err := os.Readlink(filepath.Join("/proc", strconv.Itoa(pid), "exe"))
+	if err != nil {
+		return false
+	}
+	// a binary replaced while the daemon runs is linked as "path (deleted)"
+	exe = strings.TrimSuffix(exe, " (deleted)")
+	return filepath.Base(exe) == filepath.Base(self)
+}
@@ -0,0 +1,79 @@
+package state
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"testing"
+)
+
+func TestRotation(t *testing.T) {
+	var s State
+	if got := s.Step(10); got != 10 {
+		t.Errorf("Step = %d, want the clock step", got)
+	}
+	s.Seek(10, 11) // --next
+	if got := s.Step(12); got != 13 {
+		t.Errorf("after Seek: Step = %d, want 13", got)
+	}
+	s.TogglePause(12)
+	if got := s.Step(50); got != 13 {
+		t.Errorf("paused: Step = %d, want 13", got)
+	}
+	s.Seek(50, 12) // --prev while paused
+	s.TogglePause(50)
+	if got := s.Step(51); got != 13 {
+		t.Errorf("resumed: Step = %d, want 13", got)
+	}
+
+	s.Pin("BTC-USD")
+	s.Pin("btc-usd")
+	if s.Pinned != "" {
+		t.Errorf("pinning the pinned symbol again: Pinned = %q, want unpinned", s.Pinned)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	if s, err := Load(); err != nil || s != (State{}) {
+		t.Fatalf("Load without file = %+v, %v", s, err)
+	}
+	want := State{Offset: -3, Pinned: "AAPL"}
+	if _, err := Update(func(s *State) { *s = want }); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := Load(); err != nil || got != want {
+		t.Errorf("Load = %+v, %v, want %+v", got, err, want)
+	}
+	if _, ok := DaemonPID(); ok {
+		t.Error("DaemonPID without pid file: want false")
+	}
+	remove, err := WritePID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remove()
+	if _, err := os.Stat(pidPath()); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestDaemonPIDReused checks that a leftover pid file naming another
+// program's process is ignored, so it is never signalled.
+func TestDaemonPIDReused(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	cmd := exec.Command("sleep", "10")
+	if err := cmd.Start(); err != nil {
+		t.Skip(err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+	if err := os.WriteFile(pidPath(), []byte(strconv.Itoa(cmd.Process.Pid)+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if pid, ok := DaemonPID(); ok {
+		t.Errorf("DaemonPID = %d for a sleep process, want false", pid)
+	}
+}
@@ -0,0 +1,331 @@
+// Package websocket is a minimal RFC 6455 implementation for streaming
+// price feeds: text and binary messages, fragmentation, ping/pong and close,
+// without extensions. Dial connects to ws:// and wss:// URLs; Upgrade
+// serves connections, which local stand-ins for the real feeds use in
+// tests.
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxMessage is the largest message accepted, in bytes.
+const MaxMessage = 1 << 20
+
+// Frame opcodes.
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// acceptGUID is appended to the client's key to compute Sec-WebSocket-Accept.
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// CloseError is returned by ReadMessage once the peer closed the connection.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("websocket closed (%d): %s", e.Code, e.Reason)
+	}
+	return fmt.Sprintf("websocket closed (%d)", e.Code)
+}
+
+// Conn is a WebSocket connection. One goroutine may read while others
+// write.
+type Conn struct {
+	conn   net.Conn
+	br     *bufio.Reader
+	client bool // clients mask the frames they send
+
+	wmu       sync.Mutex
+	closeOnce sync.Once
+}
+
+// Dial opens a WebSocket connection to rawURL (ws:// or wss://), sending
+// header with the handshake. ctx bounds the handshake only.
+func Dial(ctx context.Context, rawURL string, header http.Header) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	var port string
+	switch u.Scheme {
+	case "ws":
+		port = "80"
+	case "wss":
+		port = "443"
+	default:
+		return nil, fmt.Errorf("websocket: unsupported scheme %q", u.Scheme)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	var d net.Dialer
+	c, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	// the handshake must not outlive ctx; the deadline is lifted afterwards
+	stop := context.AfterFunc(ctx, func() { c.SetDeadline(time.Now()) })
+	defer stop()
+	if u.Scheme == "wss" {
+		tc := tls.Client(c, &tls.Config{ServerName: u.Hostname()})
+		if err := tc.HandshakeContext(ctx); err != nil {
+			c.Close()
+			return nil, err
+		}
+		c = tc
+	}
+
+	conn, err := handshake(c, u, header)
+	if err != nil {
+		c.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	if !stop() {
+		// ctx ended while the handshake completed
+		c.Close()
+		return nil, ctx.Err()
+	}
+	return conn, nil
+}
+
+// handshake sends the opening handshake over c and checks the reply.
+func handshake(c net.Conn, u *url.URL, header http.Header) (*Conn, error) {
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        &url.URL{Path: u.Path, RawPath: u.RawPath, RawQuery: u.RawQuery},
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     header.Clone(),
+		Host:       u.Host,
+	}
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if err := req.Write(c); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(c)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, fmt.Errorf("websocket handshake: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		resp.Body.Close()
+		return nil, fmt.Errorf("websocket handshake: %s", resp.Status)
+	}
+	if !strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") || resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		return nil, errors.New("websocket handshake: invalid upgrade response")
+	}
+	return &Conn{conn: c, br: br, client: true}, nil
+}
+
+// Upgrade answers a client's opening handshake and takes over its
+// connection.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || key == "" {
+		http.Error(w, "websocket upgrade required", http.StatusBadRequest)
+		return nil, errors.New("websocket: not an upgrade request")
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return nil, errors.New("websocket: connection cannot be hijacked")
+	}
+	c, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", acceptKey(key))
+	if err := rw.Flush(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return &Conn{conn: c, br: rw.Reader}, nil
+}
+
+func acceptKey(key string) string {
+	h := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// ReadMessage returns the next text or binary message, answering pings on
+// the way. It returns a *CloseError once the peer closes the connection.
+func (c *Conn) ReadMessage() ([]byte, error) {
+	var msg []byte
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			ce := &CloseError{Code: 1005} // no status code
+			if len(payload) >= 2 {
+				ce.Code = int(binary.BigEndian.Uint16(payload))
+				ce.Reason = string(payload[2:])
+			}
+			// echo the status code, as the closing handshake requires
+			c.closeOnce.Do(func() {
+				c.writeFrame(opClose, payload[:min(len(payload), 2)])
+				c.conn.Close()
+			})
+			return nil, ce
+		case opText, opBinary, opContinuation:
+		default:
+			return nil, fmt.Errorf("websocket: unknown opcode %#x", op)
+		}
+		if len(msg)+len(payload) > MaxMessage {
+			return nil, fmt.Errorf("websocket: message larger than %d bytes", MaxMessage)
+		}
+		msg = append(msg, payload...)
+		if fin {
+			return msg, nil
+		}
+	}
+}
+
+func (c *Conn) readFrame() (fin bool, op byte, payload []byte, err error) {
+	var h [2]byte
+	if _, err := io.ReadFull(c.br, h[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin, op = h[0]&0x80 != 0, h[0]&0x0f
+	n := uint64(h[1] & 0x7f)
+	switch n {
+	case 126:
+		var b [2]byte
+		if _, err := io.ReadFull(c.br, b[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err := io.ReadFull(c.br, b[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(b[:])
+	}
+	if n > MaxMessage {
+		return false, 0, nil, fmt.Errorf("websocket: frame larger than %d bytes", MaxMessage)
+	}
+	var mask [4]byte
+	masked := h[1]&0x80 != 0
+	if masked {
+		if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, op, payload, nil
+}
+
+// WriteText sends p as one text message.
+func (c *Conn) WriteText(p []byte) error {
+	return c.writeFrame(opText, p)
+}
+
+func (c *Conn) writeFrame(op byte, payload []byte) error {
+	buf := make([]byte, 0, 14+len(payload))
+	buf = append(buf, 0x80|op)
+	var maskBit byte
+	if c.client {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n < 126:
+		buf = append(buf, maskBit|byte(n))
+	case n <= 0xffff:
+		buf = append(buf, maskBit|126)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(n))
+	default:
+		buf = append(buf, maskBit|127)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(n))
+	}
+	if c.client {
+		var mask [4]byte
+		rand.Read(mask[:])
+		buf = append(buf, mask[:]...)
+		for i, b := range payload {
+			buf = append(buf, b^mask[i%4])
+		}
+	} else {
+		buf = append(buf, payload...)
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err := c.conn.Write(buf)
+	return err
+}
+
+// SetReadDeadline bounds the wait of the next ReadMessage.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// Close sends a normal closure and closes the connection. It is safe to
+// call more than once, and from another goroutine to abort a ReadMessage.
+func (c *Conn) Close() error {
+	err := net.ErrClosed
+	c.closeOnce.Do(func() {
+		c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+		c.writeFrame(opClose, binary.BigEndian.AppendUint16(nil, 1000))
+		err = c.conn.Close()
+	})
+	return err
+}
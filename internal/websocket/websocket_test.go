@@ -0,0 +1,114 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serve starts a WebSocket server running fn for every connection and
+// returns its ws:// URL.
+func serve(t *testing.T, fn func(*Conn)) string {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		fn(c)
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func dial(t *testing.T, url string) *Conn {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := Dial(ctx, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return c
+}
+
+func TestEcho(t *testing.T) {
+	url := serve(t, func(c *Conn) {
+		for {
+			msg, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			c.WriteText(msg)
+		}
+	})
+	c := dial(t, url)
+	// the three payload length encodings
+	for _, n := range []int{5, 300, 70000} {
+		want := bytes.Repeat([]byte("x"), n)
+		if err := c.WriteText(want); err != nil {
+			t.Fatal(err)
+		}
+		got, err := c.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("echo of %d bytes returned %d bytes", n, len(got))
+		}
+	}
+}
+
+func TestControlFrames(t *testing.T) {
+	pong := make(chan []byte, 1)
+	url := serve(t, func(c *Conn) {
+		c.writeFrame(opPing, []byte("hi"))
+		// a message split over two frames
+		c.conn.Write([]byte{opText, 3, 'a', 'b', 'c'})
+		c.conn.Write([]byte{0x80 | opContinuation, 3, 'd', 'e', 'f'})
+		_, op, payload, err := c.readFrame()
+		if err == nil && op == opPong {
+			pong <- payload
+		}
+		c.writeFrame(opClose, append([]byte{0x03, 0xe8}, "bye"...))
+		c.readFrame()
+	})
+	c := dial(t, url)
+
+	msg, err := c.ReadMessage()
+	if err != nil || string(msg) != "abcdef" {
+		t.Fatalf("ReadMessage = %q, %v; want the reassembled message", msg, err)
+	}
+	select {
+	case p := <-pong:
+		if string(p) != "hi" {
+			t.Errorf("pong payload = %q", p)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ping was not answered")
+	}
+	_, err = c.ReadMessage()
+	var ce *CloseError
+	if !errors.As(err, &ce) || ce.Code != 1000 || ce.Reason != "bye" {
+		t.Errorf("ReadMessage after close = %v", err)
+	}
+}
+
+func TestDialRejected(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	_, err := Dial(context.Background(), "ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Dial = %v, want a 404 handshake error", err)
+	}
+	if _, err := Dial(context.Background(), srv.URL, nil); err == nil {
+		t.Error("Dial accepted an http:// URL")
+	}
+}
@@ -1,40 +1,91 @@
 package main
 
 import (
+	"context"
+	_ "embed"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
-	"time"
+	"os/signal"
+	"syscall"
 
 	"github.com/bautitobal/waybar-stocks/internal/config"
-	"github.com/bautitobal/waybar-stocks/internal/fetcher"
-	"github.com/bautitobal/waybar-stocks/internal/formatter"
 )
 
+// starterConfig is the commented example written by `waybar-stocks init`.
+//
+//go:embed config.yml
+var starterConfig []byte
+
 // CLI help / usage message
 func printHelp() {
 	fmt.Print(`waybar-stocks - Custom Waybar module for displaying stock and cryptocurrency prices.
 
 USAGE:
   waybar-stocks [options]
+  waybar-stocks validate [--config <path>]
+  waybar-stocks init [--force]
+  waybar-stocks ctl [--socket <path>] <command> [args]
+
+COMMANDS:
+  validate           Check the config file and report every problem found
+  init               Write a commented starter config to
+                     $XDG_CONFIG_HOME/waybar-stocks/config.yml (--force to overwrite)
+  ctl                Control a running daemon over its Unix socket:
+                     status, quotes, refresh, next, prev, pause, pin <symbol>,
+                     reload-config, subscribe (stream its output, e.g. as the
+                     exec of a second bar)
 
 OPTIONS:
-  --config <path>    Path to the config.yml file (default: ./config.yml)
+  --config <path>    Path to the config.yml file. Without it the first of
+                     $WAYBAR_STOCKS_CONFIG, $XDG_CONFIG_HOME/waybar-stocks/config.yml,
+                     ~/.config/waybar-stocks/config.yml and ./config.yml is used
+  --daemon           Keep running and print one JSON line per update
+  --next, --prev     Show the next/previous asset (e.g. from on-scroll-up/down)
+  --pause            Pause or resume the rotation (e.g. from on-click)
+  --pin <symbol>     Pin an asset; pin it again (or pin "") to unpin
   --help             Show this help message and exit
 
 EXAMPLE:
-  waybar-stocks --config ~/.config/waybar/config.yml (if exists)
+  waybar-stocks init && waybar-stocks --daemon
 
 This program prints a JSON object to stdout that Waybar can render, for example:
   {"text": "<span color='#00FF00'>BTC (1D) 107000.00 (1.25%▲)</span>"}
+
+In --daemon mode it keeps running, refreshes every asset on refresh_interval,
+rotates on rotation_interval and prints one such object per line. --next and
+--prev move a running daemon forward and back through its control socket, as
+do SIGUSR1 and SIGUSR2.
 `)
 }
 
 func main() {
+	// Subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "validate":
+			os.Exit(runValidate(os.Args[2:]))
+		case "ctl":
+			os.Exit(runCtl(os.Args[2:]))
+		case "init":
+			os.Exit(runInit(os.Args[2:]))
+		}
+	}
+
 	// Define flags
-	configPath := flag.String("config", "config.yml", "Path to YAML config file")
+	configFlag := flag.String("config", "", "Path to YAML config file (default: searched, see --help)")
 	helpFlag := flag.Bool("help", false, "Show help and exit")
+	daemonFlag := flag.Bool("daemon", false, "Keep running and stream one JSON line per update")
+	nextFlag := flag.Bool("next", false, "Show the next asset")
+	prevFlag := flag.Bool("prev", false, "Show the previous asset")
+	pauseFlag := flag.Bool("pause", false, "Pause or resume the rotation")
+	var pin *string
+	flag.Func("pin", "Pin the asset with this symbol (again, or \"\", to unpin)", func(s string) error {
+		pin = &s
+		return nil
+	})
 
 	flag.Parse()
 
@@ -50,36 +101,91 @@ func main() {
 	}
 
 	// Load configuration
-	cfg, err := config.LoadConfig(*configPath)
+	configPath, err := config.Find(*configFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	cfg, err := config.LoadConfig(configPath)
+	if err == nil {
+		err = cfg.ConfigureProviders()
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Rotate current asset based on time
-	index := int(time.Now().Unix()/int64(cfg.RotationInterval)) % len(cfg.Assets)
-	asset := cfg.Assets[index]
+	if *nextFlag || *prevFlag || *pauseFlag || pin != nil {
+		if err := runControl(cfg, *nextFlag, *prevFlag, *pauseFlag, pin); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	// Fetch quote
-	q, err := fetcher.GetQuote(asset.Symbol, asset.Timeframe)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error fetching %s: %v\n", asset.Symbol, err)
-		os.Exit(1)
+	if *daemonFlag {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		newDaemon(cfg, configPath, os.Stdout).run(ctx)
+		return
 	}
 
-	// Format output with colors from config
-	text := formatter.FormatText(
-		cfg.Format,
-		asset.Name,
-		asset.Timeframe,
-		q.Price,
-		q.Change,
-		cfg.Colors.Up,
-		cfg.Colors.Down,
-		cfg.Colors.Neutral,
-	)
+	// Rotate the current asset (or scroll the marquee) based on time and
+	// the persisted --next/--prev/--pause/--pin state
+	step := displayStep(cfg, loadState())
+
+	// Fetch every asset concurrently (served from the shared cache while
+	// fresh) so the tooltip can summarize all of them
+	states := make([]assetState, len(cfg.Assets))
+	refreshStates(context.Background(), cfg, states, secondsOr(cfg.RefreshInterval, 60))
+	output := render(cfg, states, step)
 
 	// Print JSON for Waybar
-	output := map[string]string{"text": text}
 	json.NewEncoder(os.Stdout).Encode(output)
 }
+
+// runInit implements `waybar-stocks init` and returns the exit code.
+func runInit(args []string) int {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	force := fs.Bool("force", false, "Overwrite an existing config file")
+	fs.Parse(args)
+
+	path, err := config.DefaultPath()
+	if err == nil {
+		err = config.WriteStarter(path, starterConfig, *force)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Wrote %s\n", path)
+	return 0
+}
+
+// runValidate implements `waybar-stocks validate` and returns the exit code.
+func runValidate(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	configFlag := fs.String("config", "", "Path to YAML config file (default: searched)")
+	fs.Parse(args)
+
+	configPath, err := config.Find(*configFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		var verr *config.ValidationError
+		if errors.As(err, &verr) {
+			fmt.Fprintf(os.Stderr, "%s: %d problem(s) found\n", configPath, len(verr.Problems))
+			for _, p := range verr.Problems {
+				fmt.Fprintf(os.Stderr, "  %s\n", p)
+			}
+		} else {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", configPath, err)
+		}
+		return 1
+	}
+	fmt.Printf("%s: OK (%d assets)\n", configPath, len(cfg.Assets))
+	return 0
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bautitobal/waybar-stocks/internal/config"
+	"github.com/bautitobal/waybar-stocks/internal/fetcher"
+	"github.com/bautitobal/waybar-stocks/internal/formatter"
+)
+
+// waybarOutput is the JSON object read by a Waybar custom module with
+// "return-type": "json".
+type waybarOutput struct {
+	Text       string   `json:"text"`
+	Tooltip    string   `json:"tooltip,omitempty"`
+	Class      []string `json:"class,omitempty"`
+	Alt        string   `json:"alt,omitempty"`
+	Percentage *int     `json:"percentage,omitempty"`
+}
+
+// assetState is the latest known quote of an asset and the result of the
+// last attempt to refresh it.
+type assetState struct {
+	quote     *fetcher.Quote
+	fetchedAt time.Time
+	err       error
+	// live is set while a streaming feed keeps quote up to date
+	live bool
+}
+
+// render builds the Waybar output for step (the rotation or scroll
+// position) according to display_mode, with a tooltip summarizing every
+// asset in states.
+func render(cfg *config.Config, states []assetState, step int) waybarOutput {
+	var out waybarOutput
+	switch cfg.DisplayMode {
+	case config.DisplayAll:
+		out = renderJoined(cfg, states)
+	case config.DisplayMarquee:
+		out = renderJoined(cfg, states)
+		if formatter.Width(out.Text) > cfg.Marquee.Width {
+			out.Text = formatter.Marquee(out.Text+formatter.EscapeMarkup(cfg.Separator), step*cfg.Marquee.Step, cfg.Marquee.Width)
+		}
+	default:
+		n := len(cfg.Assets)
+		out = renderAsset(cfg, states, (step%n+n)%n)
+	}
+
+	summary := renderTooltip(cfg, states)
+	if out.Tooltip != "" {
+		out.Tooltip += "\n\n" + summary
+	} else {
+		out.Tooltip = summary
+	}
+	return out
+}
+
+// renderJoined renders every asset joined by the separator, which is plain
+// text and escaped like the asset names. Stale and error notes are collected in the tooltip and their classes kept once each.
+func renderJoined(cfg *config.Config, states []assetState) waybarOutput {
+	out := waybarOutput{Class: []string{cfg.DisplayMode}}
+	texts := make([]string, len(cfg.Assets))
+	var notes []string
+	for i := range cfg.Assets {
+		a := renderAsset(cfg, states, i)
+		texts[i] = a.Text
+		if a.Tooltip != "" {
+			notes = append(notes, a.Tooltip)
+		}
+		for _, c := range a.Class {
+			if (c == "stale" || c == "error") && !slices.Contains(out.Class, c) {
+				out.Class = append(out.Class, c)
+			}
+		}
+	}
+	out.Text = strings.Join(texts, formatter.EscapeMarkup(cfg.Separator))
+	out.Tooltip = strings.Join(notes, "\n")
+	return out
+}
+
+// renderAsset renders the asset at index. The tooltip only holds the stale
+// or error note, if any.
+func renderAsset(cfg *config.Config, states []assetState, index int) waybarOutput {
+	asset, st := cfg.Assets[index], states[index]
+	var out waybarOutput
+	err := st.err
+	if st.quote != nil && (st.err == nil || cfg.StaleFallback) {
+		var ferr error
+		if out, ferr = renderQuote(cfg, asset, st.quote); ferr != nil {
+			err = fmt.Errorf("invalid format: %v", ferr)
+		} else if st.err != nil {
+			out.Class = append(out.Class, "stale")
+			out.Tooltip = formatter.EscapeMarkup(fmt.Sprintf("Stale quote from %s: %v", st.fetchedAt.Format("2006-01-02 15:04"), st.err))
+		}
+	}
+	if out.Text == "" {
+		if err == nil {
+			err = fmt.Errorf("no quote yet")
+		}
+		out = waybarOutput{
+			Text:    formatter.EscapeMarkup(asset.Name) + " ⚠",
+			Tooltip: formatter.EscapeMarkup(fmt.Sprintf("Error fetching %s: %v", asset.Symbol, err)),
+			Class:   []string{"error"},
+			Alt:     asset.Symbol,
+		}
+	}
+	return out
+}
+
+// renderQuote renders a quote with its direction class, alt and percentage.
+func renderQuote(cfg *config.Config, asset config.Asset, q *fetcher.Quote) (waybarOutput, error) {
+	style := cfg.Style(asset)
+	text, err := formatter.Render(cfg.AssetFormat(asset), formatter.NewData(asset.Name, asset.Timeframe, q), style)
+	if err != nil {
+		return waybarOutput{}, err
+	}
+	out := waybarOutput{
+		Text:  text,
+		Class: style.Thresholds.Classes(q.Change),
+		Alt:   asset.Symbol,
+	}
+	if q.MarketState == fetcher.MarketClosed {
+		out.Class = append(out.Class, "market-closed")
+	}
+	pct := formatter.Percentage(q.Change, cfg.Percentage.Min, cfg.Percentage.Max)
+	out.Percentage = &pct
+	return out, nil
+}
+
+// renderTooltip returns one line per configured asset with its price,
+// change and timeframe.
+func renderTooltip(cfg *config.Config, states []assetState) string {
+	lines := make([]string, len(cfg.Assets))
+	for i, asset := range cfg.Assets {
+		tf := asset.Timeframe
+		if tf == "" {
+			tf = "1D"
+		}
+		q := states[i].quote
+		if q == nil {
+			lines[i] = formatter.EscapeMarkup(label(cfg, asset)) + ": ⚠ unavailable"
+			continue
+		}
+		num := cfg.Number(asset)
+		price := num.Price(q.Price)
+		if q.Currency != "" {
+			price += " " + q.Currency
+		}
+		lines[i] = formatter.EscapeMarkup(fmt.Sprintf("%s: %s (%s, %s%% %s)", label(cfg, asset), price, signed(num.Price(q.AbsChange)), signed(num.Change(q.Change)), tf))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// label is the asset name, preceded by its icon when it has one.
+func label(cfg *config.Config, asset config.Asset) string {
+	if icon := cfg.Style(asset).Icon; icon != "" {
+		return icon + " " + asset.Name
+	}
+	return asset.Name
+}
+
+// signed prefixes non-negative numbers with "+".
+func signed(s string) string {
+	if strings.HasPrefix(s, "-") {
+		return s
+	}
+	return "+" + s
+}
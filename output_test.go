@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bautitobal/waybar-stocks/internal/config"
+	"github.com/bautitobal/waybar-stocks/internal/fetcher"
+)
+
+// testConfig returns a validated config with the assets "A <1>" (AAA) and
+// "B" (BBB), shown as "{symbol} {price}" and joined by " & ".
+func testConfig(t *testing.T, mode string, staleFallback bool, width int) *config.Config {
+	t.Helper()
+	cfg, err := config.Parse(fmt.Appendf(nil, `display_mode: %s
+separator: " & "
+marquee:
+  width: %d
+stale_fallback: %v
+format: "{symbol} {price}"
+assets:
+  - symbol: AAA
+    name: A <1>
+  - symbol: BBB
+    name: B
+`, mode, width, staleFallback))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestRender(t *testing.T) {
+	fetched := time.Date(2026, 10, 15, 12, 30, 0, 0, time.Local)
+	a := assetState{quote: &fetcher.Quote{Symbol: "AAA", Price: 10, Change: 1}, fetchedAt: fetched}
+	b := assetState{quote: &fetcher.Quote{Symbol: "BBB", Price: 20, Change: -1}, fetchedAt: fetched}
+	aFailed := assetState{err: errors.New("HTTP 500")}
+	bFailed := b
+	bFailed.err = errors.New("HTTP 429")
+
+	const (
+		aText       = "<span color='#00FF00'>A &lt;1&gt; 10.00</span>"
+		bText       = "<span color='#FF5555'>B 20.00</span>"
+		sep         = " &amp; "
+		summary     = "A &lt;1&gt;: 10.00 (+0.00, +1.00% 1D)\nB: 20.00 (+0.00, -1.00% 1D)"
+		summaryNoA  = "A &lt;1&gt;: ⚠ unavailable\nB: 20.00 (+0.00, -1.00% 1D)"
+		aError      = "Error fetching AAA: HTTP 500"
+		bError      = "Error fetching BBB: HTTP 429"
+		bStaleNote  = "Stale quote from 2026-10-15 12:30: HTTP 429"
+		withSummary = "\n\n"
+	)
+	for _, tt := range []struct {
+		name     string
+		mode     string
+		fallback bool
+		states   []assetState
+		step     int
+		text     string
+		tooltip  string
+		class    []string
+	}{
+		{"rotate ok", config.DisplayRotate, false, []assetState{a, b}, 0,
+			aText, summary, []string{"up", "up-weak"}},
+		{"rotate error", config.DisplayRotate, false, []assetState{aFailed, b}, 0,
+			"A &lt;1&gt; ⚠", aError + withSummary + summaryNoA, []string{"error"}},
+		{"rotate stale", config.DisplayRotate, true, []assetState{a, bFailed}, 1,
+			bText, bStaleNote + withSummary + summary, []string{"down", "down-weak", "stale"}},
+		{"rotate stale without fallback", config.DisplayRotate, false, []assetState{a, bFailed}, 1,
+			"B ⚠", bError + withSummary + summary, []string{"error"}},
+		{"rotate wraps around", config.DisplayRotate, false, []assetState{a, b}, -1,
+			bText, summary, []string{"down", "down-weak"}},
+
+		{"all ok", config.DisplayAll, false, []assetState{a, b}, 0,
+			aText + sep + bText, summary, []string{"all"}},
+		{"all error", config.DisplayAll, false, []assetState{aFailed, b}, 0,
+			"A &lt;1&gt; ⚠" + sep + bText, aError + withSummary + summaryNoA, []string{"all", "error"}},
+		{"all stale", config.DisplayAll, true, []assetState{a, bFailed}, 0,
+			aText + sep + bText, bStaleNote + withSummary + summary, []string{"all", "stale"}},
+		{"all stale and error", config.DisplayAll, true, []assetState{aFailed, bFailed}, 0,
+			"A &lt;1&gt; ⚠" + sep + bText, aError + "\n" + bStaleNote + withSummary + summaryNoA, []string{"all", "error", "stale"}},
+		{"all stale without fallback", config.DisplayAll, false, []assetState{a, bFailed}, 0,
+			aText + sep + "B ⚠", bError + withSummary + summary, []string{"all", "error"}},
+
+		// wide enough not to scroll
+		{"marquee ok", config.DisplayMarquee, false, []assetState{a, b}, 0,
+			aText + sep + bText, summary, []string{"marquee"}},
+		{"marquee error", config.DisplayMarquee, false, []assetState{aFailed, b}, 0,
+			"A &lt;1&gt; ⚠" + sep + bText, aError + withSummary + summaryNoA, []string{"marquee", "error"}},
+		{"marquee stale", config.DisplayMarquee, true, []assetState{a, bFailed}, 0,
+			aText + sep + bText, bStaleNote + withSummary + summary, []string{"marquee", "stale"}},
+		{"marquee stale without fallback", config.DisplayMarquee, false, []assetState{a, bFailed}, 0,
+			aText + sep + "B ⚠", bError + withSummary + summary, []string{"marquee", "error"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			out := render(testConfig(t, tt.mode, tt.fallback, 100), tt.states, tt.step)
+			if out.Text != tt.text {
+				t.Errorf("text:\n  got  %q\n  want %q", out.Text, tt.text)
+			}
+			if out.Tooltip != tt.tooltip {
+				t.Errorf("tooltip:\n  got  %q\n  want %q", out.Tooltip, tt.tooltip)
+			}
+			if !slices.Equal(out.Class, tt.class) {
+				t.Errorf("class = %q, want %q", out.Class, tt.class)
+			}
+		})
+	}
+}
+
+func TestRenderAssetFields(t *testing.T) {
+	cfg := testConfig(t, config.DisplayRotate, false, 100)
+	states := []assetState{
+		{quote: &fetcher.Quote{Symbol: "AAA", Price: 10, Change: 2.5, MarketState: fetcher.MarketClosed}},
+		{err: errors.New("HTTP 500")},
+	}
+	out := render(cfg, states, 0)
+	if out.Alt != "AAA" || out.Percentage == nil || *out.Percentage != 75 {
+		t.Errorf("alt, percentage = %q, %v; want AAA, 75", out.Alt, out.Percentage)
+	}
+	if !slices.Contains(out.Class, "market-closed") {
+		t.Errorf("class = %q, want market-closed", out.Class)
+	}
+	// the error object names the asset and carries no percentage
+	out = render(cfg, states, 1)
+	if out.Alt != "BBB" || out.Percentage != nil {
+		t.Errorf("error object alt, percentage = %q, %v", out.Alt, out.Percentage)
+	}
+}
+
+func TestRenderMarqueeScroll(t *testing.T) {
+	cfg := testConfig(t, config.DisplayMarquee, false, 12)
+	states := []assetState{
+		{quote: &fetcher.Quote{Symbol: "AAA", Price: 10, Change: 1}},
+		{quote: &fetcher.Quote{Symbol: "BBB", Price: 20, Change: -1}},
+	}
+	for _, tt := range []struct {
+		step int
+		want string
+	}{
+		{0, "<span color='#00FF00'>A &lt;1&gt; 10.00</span> "},
+		// the escaped separator counts as the three characters it shows
+		{11, " &amp; <span color='#FF5555'>B 20.00</span> &amp;"},
+		// and joins the end back to the start
+		{18, "<span color='#FF5555'>.00</span> &amp; <span color='#00FF00'>A &lt;1&gt; </span>"},
+	} {
+		if got := render(cfg, states, tt.step).Text; got != tt.want {
+			t.Errorf("step %d:\n  got  %q\n  want %q", tt.step, got, tt.want)
+		}
+	}
+}
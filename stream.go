@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/bautitobal/waybar-stocks/internal/fetcher"
+)
+
+// startStreams subscribes to the ticker feeds of every asset whose provider
+// has one, when streaming is enabled. Assets pinned with coingecko_id stay
+// on REST. Ticks arrive on d.events.
+func (d *daemon) startStreams(ctx context.Context) {
+	d.stopStreams()
+	if !d.cfg.Streaming.Enabled {
+		return
+	}
+	feeds := make(map[string]fetcher.Feed)
+	d.feedAssets = make(map[string]map[string][]int)
+	for i, a := range d.cfg.Assets {
+		// feeds map symbols by ticker, which may be another coin than the
+		// pinned one
+		if a.CoinGeckoID != "" {
+			continue
+		}
+		req := assetRequest(a)
+		p, err := fetcher.Resolve(req.Provider, req.Symbol)
+		if err != nil {
+			continue
+		}
+		f, ok := fetcher.FeedFor(p.Name())
+		if !ok {
+			continue
+		}
+		key, ok := f.Key(req.Symbol)
+		if !ok {
+			continue
+		}
+		if feeds[f.Name()] == nil {
+			feeds[f.Name()] = f
+			d.feedAssets[f.Name()] = make(map[string][]int)
+		}
+		d.feedAssets[f.Name()][key] = append(d.feedAssets[f.Name()][key], i)
+	}
+	ctx, d.cancelStreams = context.WithCancel(ctx)
+	for name, f := range feeds {
+		s := &fetcher.Stream{Feed: f, Keys: slices.Sorted(maps.Keys(d.feedAssets[name]))}
+		go s.Run(ctx, d.events)
+	}
+}
+
+// stopStreams closes the feeds; their assets go back to REST polling.
+func (d *daemon) stopStreams() {
+	if d.cancelStreams != nil {
+		d.cancelStreams()
+		d.cancelStreams = nil
+	}
+	d.feedAssets = nil
+	for i := range d.states {
+		d.states[i].live = false
+	}
+}
+
+// onStream applies a feed event. A lost connection hands its assets back
+// to REST polling until ticks flow again; they keep the last streamed
+// quote until the next refresh.
+func (d *daemon) onStream(ev fetcher.StreamEvent) {
+	assets := d.feedAssets[ev.Feed]
+	if ev.Quote == nil {
+		if ev.Connected {
+			fmt.Fprintf(os.Stderr, "Streaming %s quotes\n", ev.Feed)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Stream %s down, polling until it reconnects: %v\n", ev.Feed, ev.Err)
+		for _, indexes := range assets {
+			for _, i := range indexes {
+				d.states[i].live = false
+			}
+		}
+		return
+	}
+	for _, i := range assets[ev.Key] {
+		st := &d.states[i]
+		q := fetcher.ApplyTick(st.quote, *ev.Quote, d.cfg.Assets[i].Timeframe)
+		if q == nil {
+			continue
+		}
+		st.quote, st.fetchedAt, st.err, st.live = q, time.Now(), nil, true
+	}
+	d.scheduleRedraw()
+}
+
+// scheduleRedraw prints now, or once streaming.redraw_interval has passed
+// since the last print, so fast feeds do not flood Waybar.
+func (d *daemon) scheduleRedraw() {
+	if d.redrawPending {
+		return
+	}
+	every := time.Duration(d.cfg.Streaming.RedrawInterval * float64(time.Second))
+	wait := every - time.Since(d.lastPrint)
+	if wait <= 0 {
+		d.print()
+		return
+	}
+	d.redrawPending = true
+	d.redraw.Reset(wait)
+}